@@ -0,0 +1,75 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// checkDebugInfoCommand handles "abireport check-debuginfo"
+var checkDebugInfoCommand = &cobra.Command{
+	Use:   "check-debuginfo [root]",
+	Short: "Find stripped binaries without separate debug information",
+	Long: `Examine the file tree beginning at [root], or the given packages, and
+list every stripped binary for which no separate debug file was found, along
+with its build-id if it has one.
+
+Debug files are looked up within /usr/lib/debug of the same tree, as installed
+by -debuginfo or -dbg packages, first by the GNU build-id of the binary and
+then by the CRC recorded in its .gnu_debuglink section. When scanning
+packages, pass the debug packages along with the binary packages.`,
+	Example: `
+abireport check-debuginfo extractedRootfs/
+abireport check-debuginfo packageDir/`,
+	RunE: checkDebugInfo,
+}
+
+func init() {
+	RootCmd.AddCommand(checkDebugInfoCommand)
+}
+
+// checkDebugInfo is the CLI handler for "check-debuginfo".
+func checkDebugInfo(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("check-debuginfo takes exactly one argument")
+	}
+
+	abi, err := scanSource(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot scan %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, arch := range abi.SortedArches() {
+		for _, record := range arch.CheckDebugInfo() {
+			if record.BuildID != "" {
+				fmt.Printf("%s: no debug information (build-id %s)\n", abi.InstallPath(record), record.BuildID)
+			} else {
+				fmt.Printf("%s: no debug information\n", abi.InstallPath(record))
+			}
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/clearlinux/abireport/libabi"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// checkLdCacheCommand handles "abireport check-ldcache"
+var checkLdCacheCommand = &cobra.Command{
+	Use:   "check-ldcache [root]",
+	Short: "Validate the ld.so.cache of a filesystem tree",
+	Long: `Compare the /etc/ld.so.cache within [root] with the libraries found in
+the tree. Entries pointing to files that don't exist are reported as stale,
+and libraries within a cached directory, or one of its glibc-hwcaps
+subdirectories, that have no matching entry are reported as missing.
+
+Both the old (ld.so-1.7.0) and new (glibc-ld.so.cache1.1) cache formats are
+supported.`,
+	Example: `
+abireport check-ldcache extractedRootfs/`,
+	RunE: checkLdCache,
+}
+
+func init() {
+	RootCmd.AddCommand(checkLdCacheCommand)
+}
+
+// checkLdCache is the CLI handler for "check-ldcache".
+func checkLdCache(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("check-ldcache takes exactly one argument")
+	}
+
+	resolver, err := libabi.NewResolver(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initialising resolver: %v\n", err)
+		os.Exit(1)
+	}
+
+	cache, err := resolver.LoadLdCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot load ld.so.cache: %v\n", err)
+		os.Exit(1)
+	}
+	if Verbose {
+		fmt.Fprintf(os.Stderr, "Loaded %d entries from %s cache\n", len(cache.Entries), cache.Format)
+	}
+
+	abi, err := newReport(resolver.Root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initialising libabi: %v\n", err)
+		os.Exit(1)
+	}
+	if err = abi.Walk(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error walking rootfs: %v\n", err)
+		os.Exit(1)
+	}
+
+	problems := resolver.CheckLdCache(cache, abi)
+	for _, problem := range problems {
+		kind := "stale"
+		if problem.Kind == libabi.LdCacheMissing {
+			kind = "missing"
+		}
+		fmt.Printf("%s: %s => %s", kind, problem.Soname, problem.Path)
+		if problem.HWCaps != "" {
+			fmt.Printf(" [glibc-hwcaps/%s]", problem.HWCaps)
+		}
+		fmt.Printf("\n")
+	}
+
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/clearlinux/abireport/libabi"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// checkLinksCommand handles "abireport check-links"
+var checkLinksCommand = &cobra.Command{
+	Use:   "check-links [root]",
+	Short: "Find symbols not satisfied by any linked library",
+	Long: `Examine the file tree beginning at [root], or the given packages, and
+resolve the undefined symbols of every binary against the libraries in its
+transitive DT_NEEDED closure. Every symbol that cannot be resolved is listed
+with the offending file.
+
+Libraries that are not part of the scanned set can be provided by passing a
+directory of previously generated reports with --baseline, such as the
+reports of the system libraries. ABIXML corpora may be passed instead.
+
+With --unused, the DT_NEEDED entries of every binary from which no symbol is
+used are listed instead, one $file:$soname pair per line. This is the
+equivalent of "ldd -u", and may be used to adjust linker flags such as
+--as-needed.`,
+	Example: `
+abireport check-links extractedRootfs/
+abireport check-links --baseline glibcReports/ extractedRootfs/
+abireport check-links --unused extractedRootfs/`,
+	RunE: checkLinks,
+}
+
+var (
+	// Directory of reports used to resolve libraries outside the scanned set
+	linksBaseline string
+
+	// Report unused DT_NEEDED entries instead of unresolved symbols
+	linksUnused bool
+)
+
+func init() {
+	checkLinksCommand.Flags().BoolVarP(&linksUnused, "unused", "u", false, "List needed libraries from which no symbol is used")
+	checkLinksCommand.Flags().StringVarP(&linksBaseline, "baseline", "b", "", "Directory of reports or ABIXML for libraries outside the scanned set")
+	RootCmd.AddCommand(checkLinksCommand)
+}
+
+// checkLinks is the CLI handler for "check-links".
+func checkLinks(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("check-links takes exactly one argument")
+	}
+
+	var baseline *libabi.Report
+	if linksBaseline != "" {
+		var err error
+		if libabi.IsABIXMLSource(linksBaseline) {
+			baseline, err = libabi.LoadABIXML(linksBaseline)
+		} else {
+			baseline, err = libabi.LoadReport(linksBaseline, Prefix)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot load baseline %s: %v\n", linksBaseline, err)
+			os.Exit(1)
+		}
+	}
+
+	abi, err := scanSource(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot scan %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, arch := range abi.SortedArches() {
+		var base *libabi.Architecture
+		if baseline != nil {
+			base = baseline.Arches[arch.Key()]
+		}
+		if linksUnused {
+			for _, unused := range arch.CheckOverlinking(base) {
+				fmt.Printf("%s:%s\n", abi.InstallPath(unused.Record), unused.Soname)
+				failed = true
+			}
+			continue
+		}
+		for _, unresolved := range arch.CheckUnderlinking(base) {
+			fmt.Printf("%s: undefined symbol %s\n", abi.InstallPath(unresolved.Record), libabi.DisplaySymbol(unresolved.Symbol.String()))
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/clearlinux/abireport/libabi"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// checkMultilibCommand handles "abireport check-multilib"
+var checkMultilibCommand = &cobra.Command{
+	Use:   "check-multilib [root]",
+	Short: "Compare the 64-bit and 32-bit multilib ABI",
+	Long: `Compare the exported ABI of every 32-bit multilib architecture with its
+64-bit architecture, such as i386 with x86_64, and list the sonames and
+symbols only exported by one of them. Entries only found in the 64-bit
+architecture are marked with "<", and those only found in the 32-bit
+multilib with ">". Symbols are matched by name, and --versions additionally
+lists those exported with different version nodes, marked with "~".
+
+[root] may be a directory containing previously generated report files, a
+package or directory of packages, or a filesystem tree which will be scanned
+first.`,
+	Example: `
+abireport check-multilib packages/
+abireport check-multilib reports/
+abireport check-multilib --versions reports/`,
+	RunE: checkMultilib,
+}
+
+// Also report symbols exported with different version nodes
+var multilibVersions bool
+
+func init() {
+	checkMultilibCommand.Flags().BoolVar(&multilibVersions, "versions", false, "Also list symbols exported with different version nodes")
+	RootCmd.AddCommand(checkMultilibCommand)
+}
+
+// checkMultilib is the CLI handler for "check-multilib".
+func checkMultilib(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("check-multilib takes exactly one argument")
+	}
+
+	abi, err := loadDiffSource(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot load %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+
+	diffs := libabi.CompareMultilib(abi, multilibVersions)
+	for _, diff := range diffs {
+		if err := diff.Write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write report: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
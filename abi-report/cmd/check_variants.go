@@ -0,0 +1,83 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/clearlinux/abireport/libabi"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// checkVariantsCommand handles "abireport check-variants"
+var checkVariantsCommand = &cobra.Command{
+	Use:   "check-variants [root]",
+	Short: "Compare optimized library variants with their baseline build",
+	Long: `Examine the file tree beginning at [root], or the given packages, and
+compare every optimized variant of a library with the baseline build in the
+library directory above it. Variants are found in the glibc-hwcaps
+subdirectories, such as /usr/lib64/glibc-hwcaps/x86-64-v3, and in the
+optimized subdirectories used by Clear Linux, such as /usr/lib64/haswell and
+/usr/lib64/haswell/avx512_1.
+
+Every symbol or needed library that differs from the baseline build is listed
+with the offending variant, as is any variant without a baseline build.`,
+	Example: `
+abireport check-variants extractedRootfs/
+abireport check-variants --variant-dir skylake extractedRootfs/`,
+	RunE: checkVariants,
+}
+
+// Additional optimized variant subdirectories
+var variantDirs []string
+
+func init() {
+	checkVariantsCommand.Flags().StringArrayVarP(&variantDirs, "variant-dir", "V", nil, "Additional optimized variant subdirectory of the library directories")
+	RootCmd.AddCommand(checkVariantsCommand)
+}
+
+// checkVariants is the CLI handler for "check-variants".
+func checkVariants(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("check-variants takes exactly one argument")
+	}
+	libabi.OptimizedVariants = append(libabi.OptimizedVariants, variantDirs...)
+
+	abi, err := scanSource(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot scan %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, arch := range abi.SortedArches() {
+		for _, problem := range arch.CheckVariants() {
+			if problem.Baseline == nil {
+				fmt.Printf("%s: %s\n", abi.InstallPath(problem.Record), problem.Kind)
+			} else {
+				fmt.Printf("%s: %s %s (baseline %s)\n", abi.InstallPath(problem.Record),
+					problem.Kind, libabi.DisplaySymbol(problem.Value), abi.InstallPath(problem.Baseline))
+			}
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/clearlinux/abireport/libabi"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+const (
+	// ExitDiffCompatible is returned by "diff" when only additions were found
+	ExitDiffCompatible = 2
+
+	// ExitDiffIncompatible is returned by "diff" when ABI was removed
+	ExitDiffIncompatible = 3
+)
+
+// diffCommand handles "abireport diff"
+var diffCommand = &cobra.Command{
+	Use:   "diff [old] [new]",
+	Short: "Compare two ABI reports",
+	Long: `Compare the ABI described by [old] with the ABI described by [new], and
+print the added and removed symbols per soname, soname bumps, changes to the
+used_libs and any architectures that appeared or vanished.
+
+Each of [old] and [new] may be a directory containing previously generated
+report files, an ABIXML file or directory of .abi files as written by
+libabigail's abidw, a package or directory of packages, or a filesystem tree
+which will be scanned first.
+
+The exit status is 0 when no change is found, 2 when only compatible additions
+are found, and 3 when ABI has been removed.`,
+	Example: `
+abireport diff oldReports/ newReports/
+abireport diff oldRootfs/ newRootfs/`,
+	RunE: diffReports,
+}
+
+func init() {
+	RootCmd.AddCommand(diffCommand)
+}
+
+// diffReports is the CLI handler for "diff".
+func diffReports(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("diff takes exactly two arguments")
+	}
+
+	oldReport, err := loadDiffSource(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot load %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+
+	newReport, err := loadDiffSource(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot load %s: %v\n", args[1], err)
+		os.Exit(1)
+	}
+
+	diff := libabi.Compare(oldReport, newReport)
+	if err = diff.Write(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot write diff: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch diff.Kind() {
+	case libabi.DiffCompatible:
+		os.Exit(ExitDiffCompatible)
+	case libabi.DiffIncompatible:
+		os.Exit(ExitDiffIncompatible)
+	}
+	return nil
+}
+
+// loadDiffSource will return a report for the given location, which may
+// be a directory of existing reports, ABIXML corpora, or anything accepted
+// by scanSource.
+func loadDiffSource(where string) (*libabi.Report, error) {
+	if libabi.IsReportDir(where, Prefix) {
+		return libabi.LoadReport(where, Prefix)
+	}
+	if libabi.IsABIXMLSource(where) {
+		return libabi.LoadABIXML(where)
+	}
+
+	return scanSource(where)
+}
@@ -0,0 +1,68 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// exportABIXMLCommand handles "abireport export-abixml"
+var exportABIXMLCommand = &cobra.Command{
+	Use:   "export-abixml [source]",
+	Short: "Write libabigail ABIXML corpora",
+	Long: `Write a libabigail compatible ABIXML corpus for every exported soname
+found in [source], which may be a directory containing previously generated
+report files, a package or directory of packages, or a filesystem tree which
+will be scanned first.
+
+The corpora are written into the output directory, with one directory per
+architecture named using the prefix and architecture suffix, i.e.
+abixml32/libz.so.1.abi. They describe the ELF symbols, their versions and
+types, and the needed libraries, and may be compared with abidiff or passed
+back to abireport in place of a report directory.`,
+	Example: `
+abireport export-abixml extractedRootfs/
+abidiff abixml/libz.so.1.abi upstream/libz.so.1.abi`,
+	RunE: exportABIXML,
+}
+
+func init() {
+	RootCmd.AddCommand(exportABIXMLCommand)
+}
+
+// exportABIXML is the CLI handler for "export-abixml".
+func exportABIXML(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("export-abixml takes exactly one argument")
+	}
+
+	abi, err := loadDiffSource(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot load %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+
+	for _, arch := range abi.Arches {
+		if err := abi.ReportABIXML(Prefix, arch); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write ABIXML: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	return nil
+}
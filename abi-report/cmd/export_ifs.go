@@ -0,0 +1,70 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// exportIFSCommand handles "abireport export-ifs"
+var exportIFSCommand = &cobra.Command{
+	Use:   "export-ifs [source]",
+	Short: "Write LLVM interface stubs (IFS)",
+	Long: `Write an LLVM interface stub (IFS) for every exported soname found in
+[source], which may be a directory containing previously generated report
+files, a package or directory of packages, or a filesystem tree which will be
+scanned first.
+
+The stubs are written into the output directory, with one directory per
+architecture named using the prefix and architecture suffix, i.e.
+ifs32/libz.so.1.ifs. They list the soname, the needed libraries and every
+exported symbol with its type and size, and may be turned into stub libraries
+with llvm-ifs to link against without the real libraries. Stubs have no
+notion of symbol versions, so only the default version of each symbol is
+listed.`,
+	Example: `
+abireport export-ifs extractedRootfs/
+llvm-ifs --output-elf=libz.so.1 ifs/libz.so.1.ifs`,
+	RunE: exportIFS,
+}
+
+func init() {
+	RootCmd.AddCommand(exportIFSCommand)
+}
+
+// exportIFS is the CLI handler for "export-ifs".
+func exportIFS(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("export-ifs takes exactly one argument")
+	}
+
+	abi, err := loadDiffSource(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot load %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+
+	for _, arch := range abi.Arches {
+		if err := abi.ReportIFS(Prefix, arch); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write interface stubs: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/clearlinux/abireport/libabi"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+// lddCommand handles "abireport ldd"
+var lddCommand = &cobra.Command{
+	Use:   "ldd [root] [binary]",
+	Short: "Print the libraries a binary needs within a root",
+	Long: `Emulate the dynamic loader for [binary], which is a path within [root],
+and print the tree of libraries it would load. Libraries are only ever looked
+up within [root], honouring DT_RPATH, DT_RUNPATH and the ld.so.conf of the
+root itself. Any library that cannot be found is flagged as "not found".
+
+Each library is only expanded the first time it appears in the tree.`,
+	Example: `
+abireport ldd extractedRootfs/ /usr/bin/bash`,
+	RunE: ldd,
+}
+
+func init() {
+	RootCmd.AddCommand(lddCommand)
+}
+
+// printResolved will print the library tree, returning true if any of the
+// libraries could not be found.
+func printResolved(lib *libabi.ResolvedLibrary, depth int, seen map[*libabi.ResolvedLibrary]bool) bool {
+	missing := false
+	for _, needed := range lib.Needed {
+		indent := strings.Repeat("    ", depth)
+		if needed.Missing() {
+			fmt.Printf("%s%s => not found\n", indent, needed.Name)
+			missing = true
+			continue
+		}
+		fmt.Printf("%s%s => %s\n", indent, needed.Name, needed.Path)
+		if seen[needed] {
+			continue
+		}
+		seen[needed] = true
+		if printResolved(needed, depth+1, seen) {
+			missing = true
+		}
+	}
+	return missing
+}
+
+// ldd is the CLI handler for "ldd".
+func ldd(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ldd takes exactly two arguments")
+	}
+
+	resolver, err := libabi.NewResolver(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initialising resolver: %v\n", err)
+		os.Exit(1)
+	}
+
+	tree, err := resolver.Resolve(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot resolve %s: %v\n", args[1], err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s\n", tree.Path)
+	if printResolved(tree, 1, make(map[*libabi.ResolvedLibrary]bool)) {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -17,14 +17,31 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/clearlinux/abireport/libabi"
 	"github.com/spf13/cobra"
+	"os"
+	"time"
 )
 
 var (
 	// Prefix is applied to the base of all report files to enable easier
 	// integration.
 	Prefix string
+
+	// LibDirs are additional library directories, relative to the root,
+	// whose libraries should be exported.
+	LibDirs []string
+
+	// Verbose enables printing of additional information to stderr
+	Verbose bool
+
+	// Format is the format of the generated report, "text" or "json"
+	Format string
+
+	// Output is the file the JSON report is written to, where "-" means
+	// stdout. By default it is written into the output directory.
+	Output string
 )
 
 // RootCmd is the "default command" of abireport
@@ -36,4 +53,84 @@ var RootCmd = &cobra.Command{
 func init() {
 	RootCmd.PersistentFlags().StringVarP(&Prefix, "prefix", "p", "", "Prefix for generated files")
 	RootCmd.PersistentFlags().StringVarP(&libabi.ReportOutputDir, "output-dir", "D", ".", "Output directory for reports")
+	RootCmd.PersistentFlags().StringArrayVarP(&LibDirs, "lib-dir", "L", nil, "Additional library directory within the root (repeatable)")
+	RootCmd.PersistentFlags().BoolVarP(&Verbose, "verbose", "v", false, "Print additional information")
+	RootCmd.PersistentFlags().StringVar(&Format, "format", "text", "Report format, text or json")
+	RootCmd.PersistentFlags().StringVarP(&Output, "output", "o", "", "Output file for the json format, - for stdout")
+	RootCmd.PersistentFlags().BoolVar(&libabi.LegacySymbols, "legacy-symbols", false, "Only report symbols as autospec's older abireport did")
+	RootCmd.PersistentFlags().BoolVarP(&libabi.Demangle, "demangle", "C", false, "Add the demangled name of C++ and Rust symbols")
+}
+
+// newReport will create a new report for the root, applying the global
+// library directory options.
+func newReport(root string) (*libabi.Report, error) {
+	abi, err := libabi.NewReport(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range LibDirs {
+		abi.AddLibDir(dir)
+	}
+	if Verbose {
+		for _, dir := range abi.LibDirs() {
+			fmt.Fprintf(os.Stderr, "Library directory: %s\n", dir)
+		}
+	}
+	return abi, nil
+}
+
+// printSummary will print the number of executables and shared objects
+// found for each architecture when running verbosely. The same counts are
+// part of the JSON report.
+func printSummary(abi *libabi.Report) {
+	if !Verbose {
+		return
+	}
+	for _, arch := range abi.SortedArches() {
+		counts := arch.Counts()
+		fmt.Fprintf(os.Stderr, "%s (suffix '%s'): %d executables (%d PIE), %d shared objects (%d runnable, %d plugins)\n",
+			arch.Machine, arch.GetPathSuffix(),
+			counts.Executables, counts.PIE,
+			counts.SharedObjects, counts.Runnable, counts.Plugins)
+	}
+}
+
+// writeReport will write the report files for every architecture in the
+// selected format, after truncating any stale text reports.
+func writeReport(abi *libabi.Report) error {
+	switch Format {
+	case "text":
+		if Output != "" {
+			return fmt.Errorf("--output is only supported with --format json")
+		}
+		// Ensure we clean up existing reports
+		if err := libabi.TruncateAll(Prefix); err != nil {
+			return fmt.Errorf("cannot truncate existing reports: %v", err)
+		}
+		for _, arch := range abi.Arches {
+			if err := abi.Report(Prefix, arch); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		now := time.Now()
+		switch Output {
+		case "":
+			return abi.ReportJSON(Prefix, ABIReportVersion, now)
+		case "-":
+			return abi.WriteJSON(os.Stdout, ABIReportVersion, now)
+		}
+		fi, err := os.Create(Output)
+		if err != nil {
+			return err
+		}
+		if err = abi.WriteJSON(fi, ABIReportVersion, now); err != nil {
+			fi.Close()
+			return err
+		}
+		return fi.Close()
+	default:
+		return fmt.Errorf("unknown report format: %s", Format)
+	}
 }
@@ -73,18 +73,12 @@ func scanPackages(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	// Ensure we clean up existing reports
-	if err = libabi.TruncateAll(Prefix); err != nil {
-		fmt.Fprintf(os.Stderr, "Cannot truncate existing reports: %v\n", err)
-		os.Exit(1)
-	}
+	printSummary(abi)
 
 	// Finally, create the report
-	for _, arch := range abi.Arches {
-		if err := abi.Report(Prefix, arch); err != nil {
-			fmt.Fprintf(os.Stderr, "Cannot generate report: %v\n", err)
-			os.Exit(1)
-		}
+	if err := writeReport(abi); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot generate report: %v\n", err)
+		os.Exit(1)
 	}
 }
 
@@ -106,7 +100,7 @@ func explodeAndScan(packages []string) (*libabi.Report, error) {
 	}
 
 	// Generate the ABI Report walker
-	abi, err := libabi.NewReport(root)
+	abi, err := newReport(root)
 	if err != nil {
 		return nil, err
 	}
@@ -115,6 +109,16 @@ func explodeAndScan(packages []string) (*libabi.Report, error) {
 	if err = abi.Walk(); err != nil {
 		return nil, err
 	}
+	for _, pkg := range packages {
+		abi.Packages = append(abi.Packages, filepath.Base(pkg))
+	}
+
+	// Attribute each file to its package, where the package type allows
+	for _, arch := range abi.Arches {
+		for _, record := range arch.Records {
+			record.Package = explode.Owners[record.Path]
+		}
+	}
 
 	// Pass off to next step
 	return abi, nil
@@ -53,7 +53,7 @@ func scanTree(cmd *cobra.Command, args []string) error {
 	}
 
 	// Generate the ABI Report walker
-	abi, err := libabi.NewReport(dir)
+	abi, err := newReport(dir)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initialising libabi: %v\n", err)
 		os.Exit(1)
@@ -65,19 +65,41 @@ func scanTree(cmd *cobra.Command, args []string) error {
 		os.Exit(1)
 	}
 
-	// Ensure we clean up existing reports
-	if err = libabi.TruncateAll(Prefix); err != nil {
-		fmt.Fprintf(os.Stderr, "Cannot truncate existing reports: %v\n", err)
-		os.Exit(1)
-	}
+	printSummary(abi)
 
 	// Finally, create the report
-	for _, arch := range abi.Arches {
-		if err := abi.Report(Prefix, arch); err != nil {
-			fmt.Fprintf(os.Stderr, "Cannot generate report: %v\n", err)
-			os.Exit(1)
-		}
+	if err := writeReport(abi); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot generate report: %v\n", err)
+		os.Exit(1)
 	}
 
 	return nil
 }
+
+// scanSource will return a walked report for the given location, which may
+// be a package, a directory of packages or a filesystem tree.
+func scanSource(where string) (*libabi.Report, error) {
+	st, err := os.Stat(where)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each source may use a different package type
+	exploderType = ""
+	if pkgs, err := locatePackages([]string{where}); err == nil && len(pkgs) > 0 {
+		return explodeAndScan(pkgs)
+	}
+
+	if !st.IsDir() {
+		return nil, fmt.Errorf("not a package or a directory")
+	}
+
+	abi, err := newReport(where)
+	if err != nil {
+		return nil, err
+	}
+	if err = abi.Walk(); err != nil {
+		return nil, err
+	}
+	return abi, nil
+}
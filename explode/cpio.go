@@ -0,0 +1,272 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package explode
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cpioHeaderSize = 110
+	cpioTrailer    = "TRAILER!!!"
+	cpioTypeMask   = 0170000
+	cpioTypeDir    = 0040000
+	cpioTypeFile   = 0100000
+	cpioTypeLink   = 0120000
+)
+
+// A cpioHeader holds the fields of a newc cpio header of interest
+type cpioHeader struct {
+	ino      uint64
+	mode     uint64
+	nlink    uint64
+	mtime    uint64
+	size     uint64
+	devMajor uint64
+	devMinor uint64
+	name     string
+}
+
+// cpioPad will return the padding needed to align n to 4 bytes
+func cpioPad(n uint64) int64 {
+	return int64((4 - n%4) % 4)
+}
+
+// readCpioHeader will read the next newc header and file name from r
+func readCpioHeader(r io.Reader) (*cpioHeader, error) {
+	var raw [cpioHeaderSize]byte
+	if _, err := io.ReadFull(r, raw[:]); err != nil {
+		return nil, err
+	}
+	magic := string(raw[0:6])
+	if magic != "070701" && magic != "070702" {
+		return nil, fmt.Errorf("unsupported cpio format: %q", magic)
+	}
+	// 13 fields of 8 hex digits each follow the magic
+	var fields [13]uint64
+	for i := range fields {
+		value, err := strconv.ParseUint(string(raw[6+i*8:14+i*8]), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpio header: %v", err)
+		}
+		fields[i] = value
+	}
+	namesize := fields[11]
+	if namesize == 0 || namesize > 4096 {
+		return nil, fmt.Errorf("invalid cpio file name size: %d", namesize)
+	}
+	name := make([]byte, namesize)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, cpioPad(cpioHeaderSize+namesize)); err != nil {
+		return nil, err
+	}
+	return &cpioHeader{
+		ino:      fields[0],
+		mode:     fields[1],
+		nlink:    fields[4],
+		mtime:    fields[5],
+		size:     fields[6],
+		devMajor: fields[7],
+		devMinor: fields[8],
+		name:     strings.TrimRight(string(name), "\x00"),
+	}, nil
+}
+
+// cpioMaxLinks is the number of symlinks followed when resolving a path
+// before giving up, as ELOOP would.
+const cpioMaxLinks = 40
+
+// cpioTarget will return the path to extract the entry to within rootDir.
+// Symlinks already extracted into rootDir are followed for the parent
+// directories as if rootDir were the root of the filesystem, so no entry can
+// be written outside of it.
+func cpioTarget(rootDir, name string) (string, error) {
+	clean := filepath.Clean("/" + name)
+	if clean == "/" {
+		return "", nil
+	}
+	sep := string(os.PathSeparator)
+	resolved := sep
+	pending := strings.Split(filepath.Dir(clean), sep)
+	links := 0
+	for len(pending) > 0 {
+		component := pending[0]
+		pending = pending[1:]
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, component)
+		st, err := os.Lstat(filepath.Join(rootDir, next))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err != nil || st.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		links++
+		if links > cpioMaxLinks {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", name)
+		}
+		dest, err := os.Readlink(filepath.Join(rootDir, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(dest) {
+			resolved = sep
+		}
+		pending = append(strings.Split(dest, sep), pending...)
+	}
+	return filepath.Join(rootDir, resolved, filepath.Base(clean)), nil
+}
+
+// cpioLinkTarget will resolve the target of a hardlink deferred until its
+// data was found, as later entries may have replaced its parents since.
+func cpioLinkTarget(rootDir, name string) (string, error) {
+	target, err := cpioTarget(rootDir, name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 00755); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// writeCpioFile will write size bytes of r to the regular file at target
+func writeCpioFile(r io.Reader, target string, mode os.FileMode, size uint64) error {
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(out, r, int64(size)); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// extractCpio will extract every directory, regular file and symlink of the
+// newc cpio archive read from r into rootDir, as "cpio -idmu" would, calling
+// extracted with the path of every file. Hardlinked files only carry their
+// data in the last entry, so the earlier entries are linked once it is found.
+func extractCpio(r io.Reader, rootDir string, extracted func(path string)) error {
+	type linkKey struct{ ino, devMajor, devMinor uint64 }
+	pendingLinks := make(map[linkKey][]string)
+
+	for {
+		header, err := readCpioHeader(r)
+		if err != nil {
+			return err
+		}
+		if header.name == cpioTrailer {
+			break
+		}
+		target, err := cpioTarget(rootDir, header.name)
+		if err != nil {
+			return err
+		}
+
+		if target != "" {
+			if err := os.MkdirAll(filepath.Dir(target), 00755); err != nil {
+				return err
+			}
+		}
+		mode := os.FileMode(header.mode & 07777)
+		key := linkKey{header.ino, header.devMajor, header.devMinor}
+
+		switch {
+		case target == "":
+			// The root directory itself
+		case header.mode&cpioTypeMask == cpioTypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return err
+			}
+		case header.mode&cpioTypeMask == cpioTypeLink:
+			dest := make([]byte, header.size)
+			if _, err := io.ReadFull(r, dest); err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Symlink(string(dest), target); err != nil {
+				return err
+			}
+			extracted(target)
+		case header.mode&cpioTypeMask == cpioTypeFile:
+			if header.nlink > 1 && header.size == 0 {
+				pendingLinks[key] = append(pendingLinks[key], header.name)
+				break
+			}
+			os.Remove(target)
+			if err := writeCpioFile(r, target, mode, header.size); err != nil {
+				return err
+			}
+			mtime := time.Unix(int64(header.mtime), 0)
+			os.Chtimes(target, mtime, mtime)
+			extracted(target)
+			for _, name := range pendingLinks[key] {
+				link, err := cpioLinkTarget(rootDir, name)
+				if err != nil {
+					return err
+				}
+				os.Remove(link)
+				if err := os.Link(target, link); err != nil {
+					return err
+				}
+				extracted(link)
+			}
+			delete(pendingLinks, key)
+		default:
+			// Device nodes and fifos are of no interest, skip any data
+			if _, err := io.CopyN(ioutil.Discard, r, int64(header.size)); err != nil {
+				return err
+			}
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, cpioPad(header.size)); err != nil {
+			return err
+		}
+	}
+
+	// Hardlinks of empty files never see an entry carrying data
+	for _, links := range pendingLinks {
+		for _, name := range links {
+			link, err := cpioLinkTarget(rootDir, name)
+			if err != nil {
+				return err
+			}
+			os.Remove(link)
+			if err := writeCpioFile(r, link, 00644, 0); err != nil {
+				return err
+			}
+			extracted(link)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package explode
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A cpioEntry describes a single entry written by buildCpio
+type cpioEntry struct {
+	name  string
+	mode  uint64
+	ino   uint64
+	nlink uint64
+	data  string
+}
+
+// cpioWriteEntry will append a newc header, name and data to buf
+func cpioWriteEntry(buf *bytes.Buffer, entry cpioEntry) {
+	nlink := entry.nlink
+	if nlink == 0 {
+		nlink = 1
+	}
+	fmt.Fprintf(buf, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		entry.ino, entry.mode, 0, 0, nlink, 0, len(entry.data), 0, 0, 0, 0,
+		len(entry.name)+1, 0)
+	buf.WriteString(entry.name + "\x00")
+	buf.Write(make([]byte, cpioPad(uint64(cpioHeaderSize+len(entry.name)+1))))
+	buf.WriteString(entry.data)
+	buf.Write(make([]byte, cpioPad(uint64(len(entry.data)))))
+}
+
+// buildCpio will return a newc archive of the entries, with a trailer
+func buildCpio(entries ...cpioEntry) []byte {
+	var buf bytes.Buffer
+	for i, entry := range entries {
+		if entry.ino == 0 {
+			entry.ino = uint64(i + 1)
+		}
+		cpioWriteEntry(&buf, entry)
+	}
+	cpioWriteEntry(&buf, cpioEntry{name: cpioTrailer})
+	return buf.Bytes()
+}
+
+// readTestFile will return the contents of path, failing the test on error
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestExtractCpio(t *testing.T) {
+	root := t.TempDir()
+	archive := buildCpio(
+		cpioEntry{name: "./usr/lib64", mode: cpioTypeDir | 0755},
+		cpioEntry{name: "./usr/lib64/libfoo.so.1.0", mode: cpioTypeFile | 0755, data: "foo"},
+		cpioEntry{name: "./usr/lib64/libfoo.so.1", mode: cpioTypeLink | 0777, data: "libfoo.so.1.0"},
+		cpioEntry{name: "./usr/bin/a", mode: cpioTypeFile | 0755, ino: 50, nlink: 2},
+		cpioEntry{name: "./usr/bin/b", mode: cpioTypeFile | 0755, ino: 50, nlink: 2, data: "shared"},
+		cpioEntry{name: "./usr/share/empty1", mode: cpioTypeFile | 0644, ino: 60, nlink: 2},
+		cpioEntry{name: "./usr/share/empty2", mode: cpioTypeFile | 0644, ino: 60, nlink: 2},
+		cpioEntry{name: "./dev/null", mode: 0020000 | 0666},
+	)
+
+	var got []string
+	err := extractCpio(bytes.NewReader(archive), root, func(path string) {
+		got = append(got, strings.TrimPrefix(path, root))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"/usr/lib64/libfoo.so.1.0",
+		"/usr/lib64/libfoo.so.1",
+		"/usr/bin/b",
+		"/usr/bin/a",
+		"/usr/share/empty1",
+		"/usr/share/empty2",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("extracted %v, want %v", got, want)
+	}
+	if data := readTestFile(t, filepath.Join(root, "usr/lib64/libfoo.so.1")); data != "foo" {
+		t.Errorf("symlink resolves to %q, want %q", data, "foo")
+	}
+	if data := readTestFile(t, filepath.Join(root, "usr/bin/a")); data != "shared" {
+		t.Errorf("hardlink contains %q, want %q", data, "shared")
+	}
+	if _, err := os.Lstat(filepath.Join(root, "dev/null")); !os.IsNotExist(err) {
+		t.Errorf("device node was extracted: %v", err)
+	}
+}
+
+func TestExtractCpioSymlinkEscape(t *testing.T) {
+	outside := t.TempDir()
+	tests := []struct {
+		name    string
+		entries []cpioEntry
+		want    string // Where the payload must end up, relative to root
+	}{
+		{
+			"absolute symlink",
+			[]cpioEntry{
+				{name: "./usr/lib64/evil", mode: cpioTypeLink | 0777, data: outside},
+				{name: "./usr/lib64/evil/pwned", mode: cpioTypeFile | 0644, data: "pwned"},
+			},
+			filepath.Join(outside, "pwned"),
+		},
+		{
+			"relative symlink",
+			[]cpioEntry{
+				{name: "./usr/lib64/evil", mode: cpioTypeLink | 0777, data: "../../../../../../../.." + outside},
+				{name: "./usr/lib64/evil/pwned", mode: cpioTypeFile | 0644, data: "pwned"},
+			},
+			filepath.Join(outside, "pwned"),
+		},
+		{
+			"chained symlinks",
+			[]cpioEntry{
+				{name: "./a", mode: cpioTypeLink | 0777, data: "b"},
+				{name: "./b", mode: cpioTypeLink | 0777, data: outside},
+				{name: "./a/pwned", mode: cpioTypeFile | 0644, data: "pwned"},
+			},
+			filepath.Join(outside, "pwned"),
+		},
+		{
+			"deferred hardlink",
+			[]cpioEntry{
+				{name: "./usr/lib64/evil/pwned", mode: cpioTypeFile | 0644, ino: 70, nlink: 2},
+				{name: "./usr/lib64/evil", mode: cpioTypeLink | 0777, data: outside},
+				{name: "./usr/lib64/data", mode: cpioTypeFile | 0644, ino: 70, nlink: 2, data: "pwned"},
+			},
+			filepath.Join(outside, "pwned"),
+		},
+		{
+			"usrmerge",
+			[]cpioEntry{
+				{name: "./usr/lib64", mode: cpioTypeDir | 0755},
+				{name: "./lib64", mode: cpioTypeLink | 0777, data: "usr/lib64"},
+				{name: "./lib64/pwned", mode: cpioTypeFile | 0644, data: "pwned"},
+			},
+			"/usr/lib64/pwned",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			err := extractCpio(bytes.NewReader(buildCpio(test.entries...)), root, func(string) {})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Lstat(filepath.Join(outside, "pwned")); !os.IsNotExist(err) {
+				t.Fatalf("file written outside the root: %v", err)
+			}
+			if data := readTestFile(t, filepath.Join(root, test.want)); data != "pwned" {
+				t.Errorf("%s contains %q, want %q", test.want, data, "pwned")
+			}
+		})
+	}
+}
+
+func TestExtractCpioSymlinkLoop(t *testing.T) {
+	archive := buildCpio(
+		cpioEntry{name: "./a", mode: cpioTypeLink | 0777, data: "b"},
+		cpioEntry{name: "./b", mode: cpioTypeLink | 0777, data: "a"},
+		cpioEntry{name: "./a/file", mode: cpioTypeFile | 0644, data: "x"},
+	)
+	if err := extractCpio(bytes.NewReader(archive), t.TempDir(), func(string) {}); err == nil {
+		t.Fatal("expected an error for a symlink loop")
+	}
+}
+
+func TestExtractCpioMalformed(t *testing.T) {
+	valid := buildCpio(cpioEntry{name: "./usr/bin/a", mode: cpioTypeFile | 0755, data: "data"})
+	badHex := append([]byte{}, valid...)
+	copy(badHex[6:14], "zzzzzzzz")
+	badName := append([]byte{}, valid...)
+	copy(badName[94:102], "00000000")
+	hugeName := append([]byte{}, valid...)
+	copy(hugeName[94:102], "ffffffff")
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", append([]byte("070707"), valid[6:]...)},
+		{"bad hex", badHex},
+		{"zero name size", badName},
+		{"huge name size", hugeName},
+		{"truncated header", valid[:cpioHeaderSize/2]},
+		{"truncated name", valid[:cpioHeaderSize+4]},
+		{"truncated data", valid[:cpioHeaderSize+14]},
+		{"missing trailer", valid[:cpioHeaderSize+16]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := extractCpio(bytes.NewReader(test.data), t.TempDir(), func(string) {}); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
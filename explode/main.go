@@ -27,6 +27,11 @@ var (
 	// the packages to and extracted inside. This is automatically removed
 	// at shutdown.
 	OutputDir string
+
+	// Owners maps the path of every file extracted from an RPM to the
+	// name-version-release.arch of the package it came from, so that
+	// scanned files may be attributed to their package.
+	Owners = make(map[string]string)
 )
 
 func init() {
@@ -17,11 +17,255 @@
 package explode
 
 import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+	"io"
 	"io/ioutil"
-	"os/exec"
+	"os"
 	"path/filepath"
 )
 
+const (
+	rpmLeadSize    = 96
+	rpmMaxHeader   = 256 * 1024 * 1024 // Guards against corrupt header sizes
+	rpmTypeInt32   = 4
+	rpmTypeString  = 6
+	rpmTypeI18N    = 9
+	rpmTagName     = 1000
+	rpmTagVersion  = 1001
+	rpmTagRelease  = 1002
+	rpmTagEpoch    = 1003
+	rpmTagArch     = 1022
+	rpmTagFormat   = 1124
+	rpmTagCompress = 1125
+)
+
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+// An RPMPackage describes a package as found in its RPM header
+type RPMPackage struct {
+	Name              string
+	Epoch             int32 // Zero when the package has no epoch
+	Version           string
+	Release           string
+	Arch              string
+	PayloadFormat     string // i.e. cpio
+	PayloadCompressor string // i.e. gzip, xz or zstd
+}
+
+// String will return the name-version-release.arch of the package
+func (p *RPMPackage) String() string {
+	return fmt.Sprintf("%s-%s-%s.%s", p.Name, p.Version, p.Release, p.Arch)
+}
+
+// An rpmHeader is a parsed RPM header structure, as used for both the
+// signature and the main header.
+type rpmHeader struct {
+	entries map[uint32]rpmEntry
+	store   []byte
+}
+
+// An rpmEntry is a single index entry of an RPM header
+type rpmEntry struct {
+	typ    uint32
+	offset uint32
+	count  uint32
+}
+
+// readRPMHeader will read a header structure from r, returning the header
+// and the number of bytes it occupied.
+func readRPMHeader(r io.Reader) (*rpmHeader, int, error) {
+	var intro [16]byte
+	if _, err := io.ReadFull(r, intro[:]); err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(intro[0:4], rpmHeaderMagic) {
+		return nil, 0, fmt.Errorf("invalid RPM header magic")
+	}
+	count := binary.BigEndian.Uint32(intro[8:12])
+	size := binary.BigEndian.Uint32(intro[12:16])
+	if uint64(count)*16+uint64(size) > rpmMaxHeader {
+		return nil, 0, fmt.Errorf("RPM header too large")
+	}
+
+	index := make([]byte, count*16)
+	if _, err := io.ReadFull(r, index); err != nil {
+		return nil, 0, err
+	}
+	header := &rpmHeader{
+		entries: make(map[uint32]rpmEntry),
+		store:   make([]byte, size),
+	}
+	if _, err := io.ReadFull(r, header.store); err != nil {
+		return nil, 0, err
+	}
+	for i := 0; i < len(index); i += 16 {
+		header.entries[binary.BigEndian.Uint32(index[i:])] = rpmEntry{
+			typ:    binary.BigEndian.Uint32(index[i+4:]),
+			offset: binary.BigEndian.Uint32(index[i+8:]),
+			count:  binary.BigEndian.Uint32(index[i+12:]),
+		}
+	}
+	return header, len(intro) + len(index) + len(header.store), nil
+}
+
+// stringTag will return the value of a string tag, or the first value of an
+// internationalized string tag.
+func (h *rpmHeader) stringTag(tag uint32) string {
+	entry, ok := h.entries[tag]
+	if !ok || (entry.typ != rpmTypeString && entry.typ != rpmTypeI18N) {
+		return ""
+	}
+	if entry.offset >= uint32(len(h.store)) {
+		return ""
+	}
+	value := h.store[entry.offset:]
+	if end := bytes.IndexByte(value, 0); end >= 0 {
+		value = value[:end]
+	}
+	return string(value)
+}
+
+// int32Tag will return the first value of an integer tag
+func (h *rpmHeader) int32Tag(tag uint32) int32 {
+	entry, ok := h.entries[tag]
+	if !ok || entry.typ != rpmTypeInt32 || uint64(entry.offset)+4 > uint64(len(h.store)) {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(h.store[entry.offset:]))
+}
+
+// readRPM will read the lead, signature and header of the RPM from r,
+// leaving r at the start of the compressed payload.
+func readRPM(r io.Reader) (*RPMPackage, error) {
+	var lead [rpmLeadSize]byte
+	if _, err := io.ReadFull(r, lead[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(lead[0:4], rpmLeadMagic) {
+		return nil, fmt.Errorf("not an RPM file")
+	}
+
+	// The signature is padded to a multiple of 8 bytes
+	_, size, err := readRPMHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RPM signature: %v", err)
+	}
+	if pad := (8 - size%8) % 8; pad > 0 {
+		if _, err := io.CopyN(ioutil.Discard, r, int64(pad)); err != nil {
+			return nil, err
+		}
+	}
+
+	header, _, err := readRPMHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RPM header: %v", err)
+	}
+	pkg := &RPMPackage{
+		Name:              header.stringTag(rpmTagName),
+		Epoch:             header.int32Tag(rpmTagEpoch),
+		Version:           header.stringTag(rpmTagVersion),
+		Release:           header.stringTag(rpmTagRelease),
+		Arch:              header.stringTag(rpmTagArch),
+		PayloadFormat:     header.stringTag(rpmTagFormat),
+		PayloadCompressor: header.stringTag(rpmTagCompress),
+	}
+	// Both are optional, and default to a gzip compressed cpio archive
+	if pkg.PayloadFormat == "" {
+		pkg.PayloadFormat = "cpio"
+	}
+	if pkg.PayloadCompressor == "" {
+		pkg.PayloadCompressor = "gzip"
+	}
+	return pkg, nil
+}
+
+// ReadRPMPackage will return the package described by the header of the
+// given RPM file.
+func ReadRPMPackage(path string) (*RPMPackage, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+	return readRPM(bufio.NewReader(fi))
+}
+
+// payloadReader will return a reader for the decompressed payload, along
+// with a function to release any resources held by the decompressor.
+func payloadReader(r io.Reader, compressor string) (io.Reader, func(), error) {
+	switch compressor {
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gz, func() { gz.Close() }, nil
+	case "bzip2":
+		return bzip2.NewReader(r), func() {}, nil
+	case "xz":
+		xzr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return xzr, func() {}, nil
+	case "lzma":
+		lr, err := lzma.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return lr, func() {}, nil
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+	case "identity":
+		return r, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported RPM payload compressor: %s", compressor)
+	}
+}
+
+// extractRPM will extract the payload of the RPM into rootDir, recording
+// the owner of every file extracted.
+func extractRPM(path, rootDir string) error {
+	fi, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+	r := bufio.NewReader(fi)
+
+	pkg, err := readRPM(r)
+	if err != nil {
+		return err
+	}
+	if pkg.PayloadFormat != "cpio" {
+		return fmt.Errorf("unsupported RPM payload format: %s", pkg.PayloadFormat)
+	}
+	payload, closer, err := payloadReader(r, pkg.PayloadCompressor)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	return extractCpio(payload, rootDir, func(path string) {
+		Owners[path] = pkg.String()
+	})
+}
+
 // RPM will explode all RPMs passed to it and return the path to
 // the "root" to walk.
 func RPM(pkgs []string) (string, error) {
@@ -37,27 +281,8 @@ func RPM(pkgs []string) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		rpm := exec.Command("rpm2cpio", []string{
-			fp,
-		}...)
-		cpio := exec.Command("cpio", []string{
-			"-i",
-			"-m",
-			"-d",
-			"--quiet",
-			"-u",
-		}...)
-
-		cpio.Stdin, _ = rpm.StdoutPipe()
-		cpio.Stdout = nil
-		cpio.Stderr = nil
-		cpio.Dir = rootDir
-		cpio.Start()
-		if err := rpm.Run(); err != nil {
-			return "", err
-		}
-		if err := cpio.Wait(); err != nil {
-			return "", err
+		if err := extractRPM(fp, rootDir); err != nil {
+			return "", fmt.Errorf("%s: %v", archive, err)
 		}
 	}
 
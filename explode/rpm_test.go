@@ -0,0 +1,252 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package explode
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// An rpmTag is a single tag written by buildRPMHeader
+type rpmTag struct {
+	tag   uint32
+	typ   uint32
+	value []byte
+}
+
+// stringRPMTag will return a string tag
+func stringRPMTag(tag uint32, value string) rpmTag {
+	return rpmTag{tag, rpmTypeString, []byte(value + "\x00")}
+}
+
+// buildRPMHeader will return a header structure holding the tags
+func buildRPMHeader(tags ...rpmTag) []byte {
+	var index, store bytes.Buffer
+	for _, tag := range tags {
+		binary.Write(&index, binary.BigEndian, []uint32{tag.tag, tag.typ, uint32(store.Len()), 1})
+		store.Write(tag.value)
+	}
+	var buf bytes.Buffer
+	buf.Write(rpmHeaderMagic)
+	binary.Write(&buf, binary.BigEndian, []uint32{0, uint32(len(tags)), uint32(store.Len())})
+	buf.Write(index.Bytes())
+	buf.Write(store.Bytes())
+	return buf.Bytes()
+}
+
+// buildRPM will return an RPM with the given header tags and payload
+func buildRPM(payload []byte, tags ...rpmTag) []byte {
+	var buf bytes.Buffer
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+	buf.Write(lead)
+	// A signature of a single tag, which needs padding to 8 bytes
+	sig := buildRPMHeader(rpmTag{1000, rpmTypeInt32, []byte{0, 0, 0, 1}})
+	buf.Write(sig)
+	buf.Write(make([]byte, (8-len(sig)%8)%8))
+	buf.Write(buildRPMHeader(tags...))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// compressPayload will compress data with the named RPM payload compressor,
+// skipping the test if it cannot be produced here.
+func compressPayload(t *testing.T, compressor string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch compressor {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "xz":
+		w, err = xz.NewWriter(&buf)
+	case "lzma":
+		w, err = lzma.NewWriter(&buf)
+	case "zstd":
+		w, err = zstd.NewWriter(&buf)
+	case "bzip2":
+		// The standard library can only decompress bzip2
+		path, err := exec.LookPath("bzip2")
+		if err != nil {
+			t.Skip("bzip2 is required to build the payload")
+		}
+		cmd := exec.Command(path, "-c")
+		cmd.Stdin = bytes.NewReader(data)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	case "identity":
+		return data
+	default:
+		t.Fatalf("unknown compressor %s", compressor)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeTestRPM will write the RPM to a temporary file and return its path
+func writeTestRPM(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.rpm")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractRPM(t *testing.T) {
+	payload := buildCpio(
+		cpioEntry{name: "./usr/lib64/libty.so.1", mode: cpioTypeFile | 0755, data: "ELF"},
+	)
+	for _, compressor := range []string{"gzip", "bzip2", "xz", "lzma", "zstd", "identity"} {
+		t.Run(compressor, func(t *testing.T) {
+			path := writeTestRPM(t, buildRPM(compressPayload(t, compressor, payload),
+				stringRPMTag(rpmTagName, "libty"),
+				stringRPMTag(rpmTagVersion, "1.0"),
+				stringRPMTag(rpmTagRelease, "3"),
+				stringRPMTag(rpmTagArch, "x86_64"),
+				rpmTag{rpmTagEpoch, rpmTypeInt32, []byte{0, 0, 0, 2}},
+				stringRPMTag(rpmTagFormat, "cpio"),
+				stringRPMTag(rpmTagCompress, compressor),
+			))
+
+			pkg, err := ReadRPMPackage(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := RPMPackage{"libty", 2, "1.0", "3", "x86_64", "cpio", compressor}
+			if *pkg != want {
+				t.Errorf("package %+v, want %+v", *pkg, want)
+			}
+
+			root := t.TempDir()
+			if err := extractRPM(path, root); err != nil {
+				t.Fatal(err)
+			}
+			lib := filepath.Join(root, "usr/lib64/libty.so.1")
+			if data := readTestFile(t, lib); data != "ELF" {
+				t.Errorf("extracted %q, want %q", data, "ELF")
+			}
+			if owner := Owners[lib]; owner != "libty-1.0-3.x86_64" {
+				t.Errorf("owner %q, want %q", owner, "libty-1.0-3.x86_64")
+			}
+		})
+	}
+}
+
+func TestReadRPMDefaults(t *testing.T) {
+	pkg, err := readRPM(bytes.NewReader(buildRPM(nil, stringRPMTag(rpmTagName, "libty"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.PayloadFormat != "cpio" || pkg.PayloadCompressor != "gzip" {
+		t.Errorf("payload %s/%s, want cpio/gzip", pkg.PayloadFormat, pkg.PayloadCompressor)
+	}
+}
+
+func TestReadRPMMalformed(t *testing.T) {
+	valid := buildRPM(nil, stringRPMTag(rpmTagName, "libty"))
+	sigEnd := rpmLeadSize + 16 + 16 + 4 + 4
+
+	badLead := append([]byte{}, valid...)
+	badLead[0] = 0
+	badSignature := append([]byte{}, valid...)
+	badSignature[rpmLeadSize] = 0
+	badHeader := append([]byte{}, valid...)
+	badHeader[sigEnd] = 0
+	oversized := append([]byte{}, valid...)
+	binary.BigEndian.PutUint32(oversized[sigEnd+8:], 0xffffffff)
+	binary.BigEndian.PutUint32(oversized[sigEnd+12:], 0xffffffff)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated lead", valid[:rpmLeadSize/2]},
+		{"bad lead magic", badLead},
+		{"missing signature", valid[:rpmLeadSize]},
+		{"bad signature magic", badSignature},
+		{"truncated signature", valid[:rpmLeadSize+20]},
+		{"missing padding", valid[:sigEnd-2]},
+		{"bad header magic", badHeader},
+		{"truncated header index", valid[:sigEnd+20]},
+		{"truncated header store", valid[:len(valid)-2]},
+		{"oversized header", oversized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := readRPM(bytes.NewReader(test.data)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestExtractRPMUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []rpmTag
+	}{
+		{"format", []rpmTag{stringRPMTag(rpmTagFormat, "drpm")}},
+		{"compressor", []rpmTag{stringRPMTag(rpmTagCompress, "lzip")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestRPM(t, buildRPM(nil, test.tags...))
+			if err := extractRPM(path, t.TempDir()); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestExtractRPMCorruptPayload(t *testing.T) {
+	payload := buildCpio(
+		cpioEntry{name: "./usr/lib64/libty.so.1", mode: cpioTypeFile | 0755, data: "ELF"},
+	)
+	for _, compressor := range []string{"gzip", "xz", "lzma", "zstd"} {
+		t.Run(compressor, func(t *testing.T) {
+			compressed := compressPayload(t, compressor, payload)
+			path := writeTestRPM(t, buildRPM(compressed[:len(compressed)/2],
+				stringRPMTag(rpmTagCompress, compressor)))
+			if err := extractRPM(path, t.TempDir()); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
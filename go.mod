@@ -1,5 +1,15 @@
 module github.com/clearlinux/abireport
 
-go 1.13
+go 1.24
 
-require github.com/spf13/cobra v0.0.6
+require (
+	github.com/ianlancetaylor/demangle v0.0.0-20251118225945-96ee0021ea0f
+	github.com/klauspost/compress v1.18.0
+	github.com/spf13/cobra v0.0.6
+	github.com/ulikunitz/xz v0.5.15
+)
+
+require (
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/spf13/pflag v1.0.3 // indirect
+)
@@ -0,0 +1,505 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/elf"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// abixmlVersion is the ABIXML format version we emit
+const abixmlVersion = "2.1"
+
+// abixmlArchitectures maps ELF machines to the architecture names used by
+// libabigail in ABIXML files.
+var abixmlArchitectures = map[elf.Machine]string{
+	elf.EM_386:       "elf-intel-80386",
+	elf.EM_X86_64:    "elf-amd-x86_64",
+	elf.EM_ARM:       "elf-arm",
+	elf.EM_AARCH64:   "elf-arm-aarch64",
+	elf.EM_PPC:       "elf-powerpc",
+	elf.EM_PPC64:     "elf-powerpc-64",
+	elf.EM_S390:      "elf-ibm-s390",
+	elf.EM_MIPS:      "elf-mips",
+	elf.EM_RISCV:     "elf-riscv",
+	elf.EM_LOONGARCH: "elf-loongarch",
+	elf.EM_SPARCV9:   "elf-sparc-v9",
+	elf.EM_IA_64:     "elf-intel-ia64",
+}
+
+// abixmlBindings maps ELF symbol bindings to their ABIXML names
+var abixmlBindings = map[elf.SymBind]string{
+	elf.STB_LOCAL:  "local-binding",
+	elf.STB_GLOBAL: "global-binding",
+	elf.STB_WEAK:   "weak-binding",
+	stbGNUUnique:   "gnu-unique-binding",
+}
+
+// abixmlTypes maps ELF symbol types to their ABIXML names
+var abixmlTypes = map[elf.SymType]string{
+	elf.STT_NOTYPE: "no-type",
+	elf.STT_OBJECT: "object-type",
+	elf.STT_FUNC:   "func-type",
+	elf.STT_TLS:    "tls-type",
+	elf.STT_COMMON: "common-type",
+	sttGNUIFunc:    "gnu-ifunc-type",
+}
+
+// abixmlVisibilities maps ELF symbol visibilities to their ABIXML names
+var abixmlVisibilities = map[elf.SymVis]string{
+	elf.STV_DEFAULT:   "default-visibility",
+	elf.STV_PROTECTED: "protected-visibility",
+	elf.STV_HIDDEN:    "hidden-visibility",
+	elf.STV_INTERNAL:  "internal-visibility",
+}
+
+// abixmlCorpusGroup is the root element of an ABIXML file holding several
+// corpora, such as the Linux kernel and its modules.
+type abixmlCorpusGroup struct {
+	Architecture string          `xml:"architecture,attr"`
+	Corpora      []*abixmlCorpus `xml:"abi-corpus"`
+}
+
+// abixmlCorpus is the ABI of a single shared object
+type abixmlCorpus struct {
+	XMLName      xml.Name       `xml:"abi-corpus"`
+	Version      string         `xml:"version,attr,omitempty"`
+	Path         string         `xml:"path,attr,omitempty"`
+	Architecture string         `xml:"architecture,attr,omitempty"`
+	Soname       string         `xml:"soname,attr,omitempty"`
+	Needed       *abixmlNeeded  `xml:"elf-needed"`
+	Functions    *abixmlSymbols `xml:"elf-function-symbols"`
+	Variables    *abixmlSymbols `xml:"elf-variable-symbols"`
+	Instrs       []*abixmlInstr `xml:"abi-instr"`
+}
+
+// abixmlInstr is a translation unit of a corpus, as written by abidw when
+// type information is available. Only its address size is of interest.
+type abixmlInstr struct {
+	AddressSize int `xml:"address-size,attr,omitempty"`
+}
+
+// abixmlNeeded holds the DT_NEEDED entries of a corpus
+type abixmlNeeded struct {
+	Dependencies []*abixmlDependency `xml:"dependency"`
+}
+
+// abixmlDependency is a single DT_NEEDED entry
+type abixmlDependency struct {
+	Name string `xml:"name,attr"`
+}
+
+// abixmlSymbols is the list of either the function or variable symbols
+type abixmlSymbols struct {
+	Symbols []*abixmlSymbol `xml:"elf-symbol"`
+}
+
+// abixmlSymbol is a single ELF symbol of a corpus
+type abixmlSymbol struct {
+	Name             string `xml:"name,attr"`
+	Size             uint64 `xml:"size,attr,omitempty"`
+	Version          string `xml:"version,attr,omitempty"`
+	IsDefaultVersion string `xml:"is-default-version,attr,omitempty"`
+	Type             string `xml:"type,attr"`
+	Binding          string `xml:"binding,attr"`
+	Visibility       string `xml:"visibility,attr"`
+	IsDefined        string `xml:"is-defined,attr"`
+}
+
+// newABIXMLSymbol will convert the symbol for an ABIXML corpus
+func newABIXMLSymbol(symbol *Symbol) *abixmlSymbol {
+	ret := &abixmlSymbol{
+		Name:       symbol.Name,
+		Size:       symbol.Size,
+		Version:    symbol.Version,
+		Type:       abixmlTypes[symbol.Type],
+		Binding:    abixmlBindings[symbol.Binding],
+		Visibility: abixmlVisibilities[symbol.Visibility],
+		IsDefined:  "yes",
+	}
+	if symbol.Version != "" {
+		ret.IsDefaultVersion = "yes"
+		if symbol.Hidden {
+			ret.IsDefaultVersion = "no"
+		}
+	}
+	return ret
+}
+
+// symbol will convert the ABIXML symbol back into a Symbol
+func (s *abixmlSymbol) symbol() *Symbol {
+	ret := &Symbol{
+		Name:    s.Name,
+		Version: s.Version,
+		Hidden:  s.Version != "" && s.IsDefaultVersion != "yes",
+		Size:    s.Size,
+	}
+	for bind, name := range abixmlBindings {
+		if name == s.Binding {
+			ret.Binding = bind
+		}
+	}
+	for typ, name := range abixmlTypes {
+		if name == s.Type {
+			ret.Type = typ
+		}
+	}
+	for vis, name := range abixmlVisibilities {
+		if name == s.Visibility {
+			ret.Visibility = vis
+		}
+	}
+	return ret
+}
+
+// abixmlArchitecture will return the ABIXML architecture name of the bucket
+func abixmlArchitecture(bucket *Architecture) string {
+	if name, ok := abixmlArchitectures[bucket.Machine]; ok {
+		return name
+	}
+	return "elf-unknown-arch-value"
+}
+
+// newABIXMLCorpus will create the ABIXML corpus of an exported soname
+func newABIXMLCorpus(bucket *Architecture, soname string) *abixmlCorpus {
+	ret := &abixmlCorpus{
+		Version:      abixmlVersion,
+		Path:         soname,
+		Architecture: abixmlArchitecture(bucket),
+		Soname:       soname,
+	}
+
+	if record := bucket.exportedRecord(soname); record != nil && len(record.Dependencies) > 0 {
+		ret.Needed = &abixmlNeeded{}
+		for _, dep := range record.Dependencies {
+			ret.Needed.Dependencies = append(ret.Needed.Dependencies, &abixmlDependency{Name: dep})
+		}
+	}
+
+	symbols := bucket.exportedSymbols(soname)
+	for _, symbol := range symbols {
+		if symbol.Type == elf.STT_FUNC || symbol.Type == sttGNUIFunc {
+			if ret.Functions == nil {
+				ret.Functions = &abixmlSymbols{}
+			}
+			ret.Functions.Symbols = append(ret.Functions.Symbols, newABIXMLSymbol(symbol))
+		} else {
+			if ret.Variables == nil {
+				ret.Variables = &abixmlSymbols{}
+			}
+			ret.Variables.Symbols = append(ret.Variables.Symbols, newABIXMLSymbol(symbol))
+		}
+	}
+	return ret
+}
+
+// WriteABIXML will write the ABIXML corpus of an exported soname to w, in
+// the format used by libabigail's abidw and abidiff. Only the ELF symbols
+// and dependencies are described. The prototypes and layouts collected from
+// DWARF are dropped, as they are recorded as C declarations and cannot be
+// turned back into the type graph libabigail expects.
+func (a *Architecture) WriteABIXML(w io.Writer, soname string) error {
+	data, err := xml.MarshalIndent(newABIXMLCorpus(a, soname), "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// ReportABIXML will write an ABIXML corpus for every exported soname of the
+// bucket into the ReportOutputDir, within a directory named using the given
+// prefix and the suffix of the bucket, i.e. abixml32/libz.so.1.abi
+func (a *Report) ReportABIXML(prefix string, bucket *Architecture) error {
+	dir := filepath.Join(ReportOutputDir, fmt.Sprintf("%sabixml%s", prefix, bucket.GetPathSuffix()))
+	if err := os.MkdirAll(dir, 00755); err != nil {
+		return err
+	}
+	for _, soname := range exportedSonames(bucket) {
+		fi, err := os.Create(filepath.Join(dir, soname+".abi"))
+		if err != nil {
+			return err
+		}
+		err = bucket.WriteABIXML(fi, soname)
+		fi.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readABIXML will read every corpus from an ABIXML file, which may either
+// hold a single corpus or a corpus group.
+func readABIXML(r io.Reader) ([]*abixmlCorpus, error) {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "abi-corpus":
+			corpus := &abixmlCorpus{}
+			if err := dec.DecodeElement(corpus, &start); err != nil {
+				return nil, err
+			}
+			return []*abixmlCorpus{corpus}, nil
+		case "abi-corpus-group":
+			group := &abixmlCorpusGroup{}
+			if err := dec.DecodeElement(group, &start); err != nil {
+				return nil, err
+			}
+			for _, corpus := range group.Corpora {
+				if corpus.Architecture == "" {
+					corpus.Architecture = group.Architecture
+				}
+			}
+			return group.Corpora, nil
+		default:
+			return nil, fmt.Errorf("not an ABIXML file: unexpected <%s>", start.Name.Local)
+		}
+	}
+}
+
+// addressSize will return the address size of the corpus in bits, as
+// recorded by its translation units, or 0 when unknown.
+func (c *abixmlCorpus) addressSize() int {
+	for _, instr := range c.Instrs {
+		if instr.AddressSize != 0 {
+			return instr.AddressSize
+		}
+	}
+	return 0
+}
+
+// architectureForABIXML will return a new, empty Architecture for the
+// corpus. ABIXML only records the ELF machine, so the ELF class is taken
+// from the address size of the corpus, and hint is the architecture implied
+// by the directory the corpus was found in, if any. An error is returned
+// when the machine is shared by several known architectures that cannot be
+// told apart, such as ppc64 and ppc64le.
+func architectureForABIXML(corpus *abixmlCorpus, hint *Architecture) (*Architecture, error) {
+	var machine elf.Machine
+	found := false
+	for m, archName := range abixmlArchitectures {
+		if archName == corpus.Architecture {
+			machine = m
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown ABIXML architecture: %s", corpus.Architecture)
+	}
+
+	class := elf.ELFCLASSNONE
+	switch corpus.addressSize() {
+	case 32:
+		class = elf.ELFCLASS32
+	case 64:
+		class = elf.ELFCLASS64
+	}
+	if hint != nil && hint.Machine == machine && (class == elf.ELFCLASSNONE || class == hint.Class) {
+		return hint, nil
+	}
+
+	var candidates []string
+	known := false
+	for _, m := range machineTable {
+		if m.machine != machine {
+			continue
+		}
+		known = true
+		if class == elf.ELFCLASSNONE || m.class == class {
+			candidates = append(candidates, m.suffix)
+		}
+	}
+	if !known {
+		return NewArchitecture(machine), nil
+	}
+	if len(candidates) != 1 {
+		return nil, fmt.Errorf("cannot tell the ELF class and data encoding of ABIXML architecture %s, place the corpus in a directory named abixml<suffix> as written by export-abixml", corpus.Architecture)
+	}
+	arch, _ := ArchitectureForSuffix(candidates[0])
+	return arch, nil
+}
+
+// abixmlDirHint will return the architecture implied by the name of a
+// directory written by ReportABIXML, i.e. abixmlppc64 or p_abixml32, or
+// nil when the name does not identify one.
+func abixmlDirHint(dir string) *Architecture {
+	base := filepath.Base(dir)
+	idx := strings.LastIndex(base, "abixml")
+	if idx < 0 {
+		return nil
+	}
+	if arch, ok := ArchitectureForSuffix(base[idx+len("abixml"):]); ok {
+		return arch
+	}
+	return nil
+}
+
+// isABIXMLFile will determine whether the root element of the file is an
+// ABIXML corpus or corpus group, regardless of its extension.
+func isABIXMLFile(path string) bool {
+	fi, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer fi.Close()
+	// The root element follows the XML declaration and any comments
+	dec := xml.NewDecoder(io.LimitReader(fi, 64*1024))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local == "abi-corpus" || start.Name.Local == "abi-corpus-group"
+		}
+	}
+}
+
+// abixmlFiles will return the ABIXML files of a directory, which are those
+// with the .abi or .xml extension holding an ABIXML root element.
+func abixmlFiles(dir string) ([]string, error) {
+	var ret []string
+	for _, pattern := range []string{"*.abi", "*.xml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if isABIXMLFile(match) {
+				ret = append(ret, match)
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// IsABIXMLSource will determine whether p is an ABIXML file, or a directory
+// containing ABIXML files.
+func IsABIXMLSource(p string) bool {
+	st, err := os.Stat(p)
+	if err != nil {
+		return false
+	}
+	if !st.IsDir() {
+		return isABIXMLFile(p)
+	}
+	files, _ := abixmlFiles(p)
+	return len(files) > 0
+}
+
+// LoadABIXML will create a Report from ABIXML corpora, as written by
+// libabigail's abidw or by ReportABIXML, so that they may be used wherever
+// a previously generated report is accepted. p may be a single file, or a
+// directory whose ABIXML files are all loaded.
+//
+// As with LoadReport, the returned Report has no records and cannot be
+// walked.
+func LoadABIXML(p string) (*Report, error) {
+	paths := []string{p}
+	if st, err := os.Stat(p); err != nil {
+		return nil, err
+	} else if st.IsDir() {
+		if paths, err = abixmlFiles(p); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &Report{
+		Root:   p,
+		Arches: make(map[ArchitectureKey]*Architecture),
+	}
+	for _, path := range paths {
+		fi, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		corpora, err := readABIXML(fi)
+		fi.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		hint := abixmlDirHint(filepath.Dir(path))
+		for _, corpus := range corpora {
+			arch, err := architectureForABIXML(corpus, hint)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			bucket, ok := report.Arches[arch.Key()]
+			if !ok {
+				bucket = arch
+				report.Arches[arch.Key()] = bucket
+			}
+			corpus.store(bucket)
+		}
+	}
+	return report, nil
+}
+
+// store will add the exported symbols and dependencies of the corpus into
+// the bucket.
+func (c *abixmlCorpus) store(bucket *Architecture) {
+	soname := c.Soname
+	if soname == "" {
+		soname = filepath.Base(c.Path)
+	}
+	symbols, ok := bucket.Symbols[soname]
+	if !ok {
+		symbols = make(map[string]bool)
+		bucket.Symbols[soname] = symbols
+	}
+	for _, list := range []*abixmlSymbols{c.Functions, c.Variables} {
+		if list == nil {
+			continue
+		}
+		for _, sym := range list.Symbols {
+			if sym.IsDefined == "no" || strings.TrimSpace(sym.Name) == "" {
+				continue
+			}
+			if LegacySymbols {
+				symbols[sym.Name] = true
+			} else {
+				symbols[sym.symbol().String()] = true
+			}
+		}
+	}
+	if c.Needed != nil {
+		for _, dep := range c.Needed.Dependencies {
+			bucket.Dependencies[dep.Name] = true
+		}
+	}
+}
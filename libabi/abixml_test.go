@@ -0,0 +1,193 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestFile will write the content to name within dir
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestABIXMLRoundTrip(t *testing.T) {
+	for _, suffix := range []string{"", "x32", "ppc64", "ppc64le", "armhf"} {
+		t.Run(suffix, func(t *testing.T) {
+			bucket, ok := ArchitectureForSuffix(suffix)
+			if !ok {
+				t.Fatalf("unknown suffix %q", suffix)
+			}
+			symbols := []*Symbol{
+				{Name: "foo", Version: "FOO_1", Type: elf.STT_FUNC, Binding: elf.STB_GLOBAL},
+				{Name: "foo", Version: "FOO_0", Hidden: true, Type: elf.STT_FUNC, Binding: elf.STB_GLOBAL},
+				{Name: "foo_data", Type: elf.STT_OBJECT, Binding: elf.STB_WEAK, Size: 8},
+				{Name: "foo_ifunc", Type: sttGNUIFunc, Binding: elf.STB_GLOBAL, Visibility: elf.STV_PROTECTED},
+			}
+			bucket.Records = []*Record{{
+				Name:         "libfoo.so.1",
+				Flags:        RecordTypeLibrary | RecordTypeExport,
+				Dependencies: []string{"libc.so.6"},
+				Symbols:      symbols,
+			}}
+			want := make(map[string]bool)
+			for _, symbol := range symbols {
+				want[symbol.String()] = true
+			}
+			bucket.Symbols["libfoo.so.1"] = want
+
+			dir := t.TempDir()
+			oldDir := ReportOutputDir
+			ReportOutputDir = dir
+			defer func() { ReportOutputDir = oldDir }()
+
+			report := &Report{Arches: map[ArchitectureKey]*Architecture{bucket.Key(): bucket}}
+			if err := report.ReportABIXML("", bucket); err != nil {
+				t.Fatal(err)
+			}
+			source := filepath.Join(dir, "abixml"+suffix)
+			if !IsABIXMLSource(source) {
+				t.Fatalf("%s is not detected as ABIXML", source)
+			}
+			loaded, err := LoadABIXML(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := loaded.Arches[bucket.Key()]
+			if !ok || len(loaded.Arches) != 1 {
+				t.Fatalf("corpus was not loaded as %s", bucket.GetPathSuffix())
+			}
+			if !reflect.DeepEqual(got.Symbols["libfoo.so.1"], want) {
+				t.Errorf("symbols %v, want %v", got.Symbols["libfoo.so.1"], want)
+			}
+			if !got.Dependencies["libc.so.6"] {
+				t.Errorf("dependency on libc.so.6 was lost")
+			}
+		})
+	}
+}
+
+func TestIsABIXMLSource(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"corpus.abi", "<abi-corpus architecture='elf-amd-x86_64'/>", true},
+		{"group.txt", "<?xml version='1.0'?>\n<!-- abidw -->\n<abi-corpus-group architecture='elf-amd-x86_64'/>", true},
+		{"other.xml", "<?xml version='1.0'?>\n<project><abi-corpus/></project>", false},
+		{"truncated.abi", "<?xml version='1.0'?>\n<abi-cor", false},
+		{"symbols", "libfoo.so.1:foo\n", false},
+		{"empty.xml", "", false},
+	}
+	for _, test := range tests {
+		path := writeTestFile(t, dir, test.name, test.content)
+		if got := IsABIXMLSource(path); got != test.want {
+			t.Errorf("IsABIXMLSource(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+	if IsABIXMLSource(filepath.Join(dir, "missing.abi")) {
+		t.Errorf("missing file detected as ABIXML")
+	}
+
+	xmlDir := filepath.Join(t.TempDir(), "xml")
+	writeTestFile(t, xmlDir, "pom.xml", "<project/>")
+	if IsABIXMLSource(xmlDir) {
+		t.Errorf("directory without ABIXML detected as ABIXML")
+	}
+	writeTestFile(t, xmlDir, "libfoo.so.1.xml", "<abi-corpus architecture='elf-intel-80386' soname='libfoo.so.1'/>")
+	if !IsABIXMLSource(xmlDir) {
+		t.Errorf("directory with ABIXML not detected")
+	}
+	report, err := LoadABIXML(xmlDir)
+	if err != nil {
+		t.Fatalf("non-ABIXML files should be skipped: %v", err)
+	}
+	if _, ok := report.Arches[mustArchitecture(t, "32").Key()]; !ok {
+		t.Errorf("corpus was not loaded as i386")
+	}
+}
+
+// mustArchitecture will return the architecture for the report suffix
+func mustArchitecture(t *testing.T, suffix string) *Architecture {
+	t.Helper()
+	arch, ok := ArchitectureForSuffix(suffix)
+	if !ok {
+		t.Fatalf("unknown suffix %q", suffix)
+	}
+	return arch
+}
+
+func TestLoadABIXMLArchitecture(t *testing.T) {
+	const instr64 = "<abi-instr address-size='64' path='foo.c'/>"
+	const instr32 = "<abi-instr address-size='32' path='foo.c'/>"
+	tests := []struct {
+		name    string
+		dir     string
+		content string
+		want    string // Expected suffix, or "error"
+	}{
+		{"x86_64 by address size", "plain", "<abi-corpus architecture='elf-amd-x86_64'>" + instr64 + "</abi-corpus>", ""},
+		{"x32 by address size", "plain", "<abi-corpus architecture='elf-amd-x86_64'>" + instr32 + "</abi-corpus>", "x32"},
+		{"x86_64 without address size", "plain", "<abi-corpus architecture='elf-amd-x86_64'/>", "error"},
+		{"x32 by directory", "p_abixmlx32", "<abi-corpus architecture='elf-amd-x86_64'/>", "x32"},
+		{"ppc64 by directory", "abixmlppc64", "<abi-corpus architecture='elf-powerpc-64'>" + instr64 + "</abi-corpus>", "ppc64"},
+		{"ppc64 without directory", "plain", "<abi-corpus architecture='elf-powerpc-64'>" + instr64 + "</abi-corpus>", "error"},
+		{"directory of another machine", "abixmlppc64", "<abi-corpus architecture='elf-arm-aarch64'/>", "aarch64"},
+		{"group architecture", "plain", "<abi-corpus-group architecture='elf-ibm-s390'><abi-corpus>" + instr32 + "</abi-corpus></abi-corpus-group>", "s390"},
+		{"unknown machine", "plain", "<abi-corpus architecture='elf-sparc-v9'/>", "EM_SPARCV9"},
+		{"unknown architecture", "plain", "<abi-corpus architecture='elf-vax'/>", "error"},
+		{"malformed", "plain", "<abi-corpus architecture='elf-amd-x86_64'><elf-needed>", "error"},
+		{"unexpected root", "plain", "<abi-instr/>", "error"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestFile(t, filepath.Join(t.TempDir(), test.dir), "libfoo.so.1.abi", test.content)
+			report, err := LoadABIXML(path)
+			if test.want == "error" {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Arches) != 1 {
+				t.Fatalf("loaded %d architectures", len(report.Arches))
+			}
+			for _, arch := range report.Arches {
+				if got := arch.GetPathSuffix(); got != test.want {
+					t.Errorf("loaded as %q, want %q", got, test.want)
+				}
+			}
+		})
+	}
+}
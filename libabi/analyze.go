@@ -19,10 +19,140 @@ package libabi
 import (
 	"debug/elf"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"strings"
 )
 
+// readABIFlags will read the processor specific flags (e_flags) from the
+// ELF header, which debug/elf does not expose.
+func readABIFlags(r io.ReaderAt, file *elf.File) (uint32, error) {
+	offset := int64(36)
+	if file.Class == elf.ELFCLASS64 {
+		offset = 48
+	}
+	var buf [4]byte
+	if _, err := r.ReadAt(buf[:], offset); err != nil {
+		return 0, err
+	}
+	return file.ByteOrder.Uint32(buf[:]), nil
+}
+
+// architectureOf will return a new, empty Architecture describing the ELF
+// file at p, along with the file type.
+func architectureOf(p string) (*Architecture, elf.Type, error) {
+	fi, err := os.Open(p)
+	if err != nil {
+		return nil, elf.ET_NONE, err
+	}
+	defer fi.Close()
+	file, err := elf.NewFile(fi)
+	if err != nil {
+		return nil, elf.ET_NONE, err
+	}
+	flags, err := readABIFlags(fi, file)
+	if err != nil {
+		return nil, elf.ET_NONE, err
+	}
+	arch := NewArchitecture(file.Machine)
+	arch.Class = file.Class
+	arch.Data = file.Data
+	arch.ABIFlags = flags
+	return arch, file.Type, nil
+}
+
+// sectionName will return the name of the section the symbol is defined
+// in, or an empty string for special sections such as SHN_ABS.
+func sectionName(file *elf.File, sym elf.Symbol) string {
+	if sym.Section < elf.SectionIndex(len(file.Sections)) {
+		return file.Sections[sym.Section].Name
+	}
+	return ""
+}
+
+// isLegacyExport will try our best to emulate nm -g --defined-only --dynamic
+// behaviour, as used in autospec's older abireport. Only non-weak symbols in
+// the .text section, and absolute symbols, are considered.
+func isLegacyExport(file *elf.File, sym elf.Symbol) bool {
+	// Skip weak symbols (this also matches STB_GNU_UNIQUE)
+	if elf.ST_BIND(sym.Info)&elf.STB_WEAK == elf.STB_WEAK {
+		return false
+	}
+	// If its not an absolute *and* its not in text, skip it too.
+	if sym.Section&elf.SHN_ABS != elf.SHN_ABS && sectionName(file, sym) != ".text" {
+		return false
+	}
+	// Skip STT_GNU_IFUNC
+	return elf.ST_TYPE(sym.Info) != sttGNUIFunc
+}
+
+// isFunctionDescriptor will determine if the function symbol lives in the
+// .opd section of a ppc64 ELFv1 file, where every function symbol points to
+// a descriptor rather than the code itself.
+func isFunctionDescriptor(file *elf.File, section *elf.Section) bool {
+	return file.Machine == elf.EM_PPC64 && section.Name == ".opd"
+}
+
+// isExportedSection will determine if the section the symbol is defined in
+// holds exported ABI, based on the section flags rather than the name. This
+// covers functions in any executable section, such as .text.hot or custom
+// sections, and data objects or TLS variables in any allocated section.
+// Untyped symbols are only exported from executable sections, which skips
+// the linker generated markers such as _edata, _end and __bss_start.
+func isExportedSection(file *elf.File, sym elf.Symbol) bool {
+	if sym.Section >= elf.SectionIndex(len(file.Sections)) {
+		return false
+	}
+	section := file.Sections[sym.Section]
+	if section.Flags&elf.SHF_ALLOC != elf.SHF_ALLOC {
+		return false
+	}
+	switch elf.ST_TYPE(sym.Info) {
+	case elf.STT_FUNC, sttGNUIFunc:
+		if isFunctionDescriptor(file, section) {
+			return true
+		}
+		return section.Flags&elf.SHF_EXECINSTR == elf.SHF_EXECINSTR
+	case elf.STT_NOTYPE:
+		return section.Flags&elf.SHF_EXECINSTR == elf.SHF_EXECINSTR
+	default:
+		return true
+	}
+}
+
+// isDefinition will determine if the symbol is a global, weak or unique
+// definition that other objects may bind to at runtime.
+func isDefinition(sym elf.Symbol) bool {
+	if sym.Section == elf.SHN_UNDEF {
+		return false
+	}
+	switch elf.ST_BIND(sym.Info) {
+	case elf.STB_GLOBAL, elf.STB_WEAK, stbGNUUnique:
+	default:
+		return false
+	}
+	switch elf.ST_VISIBILITY(sym.Other) {
+	case elf.STV_DEFAULT, elf.STV_PROTECTED:
+		return true
+	default:
+		return false
+	}
+}
+
+// isExport will determine if the symbol is part of the exported ABI, which
+// covers every defined global, weak or unique symbol in an exported section,
+// or absolute symbols, that other objects may bind to.
+func isExport(file *elf.File, sym elf.Symbol) bool {
+	if !isDefinition(sym) {
+		return false
+	}
+	if sym.Section == elf.SHN_ABS {
+		return true
+	}
+	return isExportedSection(file, sym)
+}
+
 // isLibraryDir will determine if a path is a valid library path worth
 // exporting, i.e. /usr/lib64, etc.
 func (a *Report) isLibraryDir(dir string) bool {
@@ -34,6 +164,24 @@ func (a *Report) isLibraryDir(dir string) bool {
 	return false
 }
 
+// variantDir will split a directory into the library directory and the
+// optimized variant subdirectory it represents, i.e. "haswell/avx512_1" or
+// "glibc-hwcaps/x86-64-v3". The variant is empty if dir is not a variant of
+// a library directory.
+func (a *Report) variantDir(dir string) (string, string) {
+	parent := filepath.Dir(dir)
+	if filepath.Base(parent) == "glibc-hwcaps" && a.isLibraryDir(filepath.Dir(parent)) {
+		return filepath.Dir(parent), filepath.Join("glibc-hwcaps", filepath.Base(dir))
+	}
+	for _, variant := range OptimizedVariants {
+		base := strings.TrimSuffix(dir, "/"+variant)
+		if base != dir && a.isLibraryDir(base) {
+			return base, variant
+		}
+	}
+	return dir, ""
+}
+
 // analyzeLibrary will examine the given shared library and populate
 // the soname and symbols fields of the record
 func (a *Report) analyzeLibrary(record *Record, file *elf.File) error {
@@ -50,9 +198,12 @@ func (a *Report) analyzeLibrary(record *Record, file *elf.File) error {
 		record.Name = filepath.Base(record.Path)
 	}
 
-	// Unexport anything not in a library directory
+	// Unexport anything not in a library directory, and the optimized
+	// variants which are only checked against their baseline, even when
+	// their directory was passed as a library directory.
 	dirName := filepath.Dir(record.Path)
-	if !a.isLibraryDir(dirName) && record.Flags&RecordTypeExport == RecordTypeExport {
+	_, record.Variant = a.variantDir(dirName)
+	if (record.Variant != "" || !a.isLibraryDir(dirName)) && record.Flags&RecordTypeExport == RecordTypeExport {
 		record.Flags ^= RecordTypeExport
 	}
 
@@ -61,53 +212,187 @@ func (a *Report) analyzeLibrary(record *Record, file *elf.File) error {
 		return err
 	}
 
-	nSections := elf.SectionIndex(len(file.Sections))
-
-	// Try out best to emulate nm -g --defined-only --dynamic behaviour,
-	// as used in autospec's older abireport.
 	for _, sym := range symbols {
-		// We only care for defined symbols
-		// We want things in the .text section, and absolute symbols.
-		inText := false
-		sbind := elf.ST_BIND(sym.Info)
-		// Skip weak symbols
-		if sbind&elf.STB_WEAK == elf.STB_WEAK {
+		if LegacySymbols {
+			if !isLegacyExport(file, sym) {
+				continue
+			}
+		} else if !isExport(file, sym) {
 			continue
 		}
-		if sym.Section < nSections && file.Sections[sym.Section].Name == ".text" {
-			inText = true
-		}
-		// If its not an absolute *and* its not in text, skip it too.
-		if sym.Section&elf.SHN_ABS != elf.SHN_ABS && !inText {
+		// Skip unnamed ABI
+		nom := strings.TrimSpace(sym.Name)
+		if nom == "" {
 			continue
 		}
-		symType := elf.ST_TYPE(sym.Info)
-		// Skip STT_GNU_IFUNC
-		if symType == elf.STT_LOOS {
+		symbol := &Symbol{
+			Name:       nom,
+			Binding:    elf.ST_BIND(sym.Info),
+			Type:       elf.ST_TYPE(sym.Info),
+			Visibility: elf.ST_VISIBILITY(sym.Other),
+			Size:       sym.Size,
+			Value:      sym.Value,
+		}
+		if sym.HasVersion {
+			symbol.Version = sym.Version
+			symbol.Hidden = sym.VersionIndex.IsHidden()
+		}
+		record.Symbols = append(record.Symbols, symbol)
+	}
+
+	return a.analyzeVersions(record, file)
+}
+
+// analyzeVersions will store the version definition tree of the library,
+// omitting the base definition which merely repeats the soname.
+func (a *Report) analyzeVersions(record *Record, file *elf.File) error {
+	// Unversioned libraries simply have no .gnu.version_d
+	if file.SectionByType(elf.SHT_GNU_VERDEF) == nil {
+		return nil
+	}
+
+	versions, err := file.DynamicVersions()
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		if version.Flags&elf.VER_FLG_BASE == elf.VER_FLG_BASE {
 			continue
 		}
-		// Skip unnamed ABI
+		record.Versions = append(record.Versions, &VersionDefinition{
+			Name:    version.Name,
+			Parents: version.Deps,
+		})
+	}
+	return nil
+}
+
+// analyzeImports will store the undefined dynamic symbols of the file,
+// along with the versions it requires from each of its libraries. Every
+// defined dynamic symbol is stored too, regardless of the report filters,
+// as these are what imports are resolved against at runtime.
+func (a *Report) analyzeImports(record *Record, file *elf.File) error {
+	symbols, err := file.DynamicSymbols()
+	if err != nil {
+		// Static binaries have no dynamic symbol table
+		if err == elf.ErrNoSymbols {
+			return nil
+		}
+		return err
+	}
+
+	for _, sym := range symbols {
 		nom := strings.TrimSpace(sym.Name)
 		if nom == "" {
 			continue
 		}
-		record.Symbols = append(record.Symbols, nom)
+		if isDefinition(sym) {
+			symbol := &Symbol{
+				Name:    nom,
+				Binding: elf.ST_BIND(sym.Info),
+				Type:    elf.ST_TYPE(sym.Info),
+			}
+			if sym.HasVersion {
+				symbol.Version = sym.Version
+				symbol.Hidden = sym.VersionIndex.IsHidden()
+			}
+			record.Definitions = append(record.Definitions, symbol)
+			continue
+		}
+		if sym.Section != elf.SHN_UNDEF {
+			continue
+		}
+		record.Imports = append(record.Imports, &Symbol{
+			Name:      nom,
+			Version:   sym.Version,
+			Undefined: true,
+			Library:   sym.Library,
+			Binding:   elf.ST_BIND(sym.Info),
+			Type:      elf.ST_TYPE(sym.Info),
+		})
+	}
+
+	if file.SectionByType(elf.SHT_GNU_VERNEED) == nil {
+		return nil
+	}
+
+	needs, err := file.DynamicVersionNeeds()
+	if err != nil {
+		return err
+	}
+	for _, need := range needs {
+		req := &VersionRequirement{Library: need.Name}
+		for _, dep := range need.Needs {
+			req.Versions = append(req.Versions, dep.Dep)
+		}
+		record.Requirements = append(record.Requirements, req)
 	}
 	return nil
 }
 
+// classifyDynamic will determine the RecordType of an ET_DYN file, which
+// may be a shared library, a PIE executable, or a shared library that can
+// also be run directly, such as libc.so.6
+func classifyDynamic(file *elf.File) (RecordType, error) {
+	hasInterp := false
+	for _, prog := range file.Progs {
+		if prog.Type == elf.PT_INTERP {
+			hasInterp = true
+			break
+		}
+	}
+
+	flags1, err := file.DynValue(elf.DT_FLAGS_1)
+	if err != nil {
+		return 0, err
+	}
+	isPIE := false
+	for _, flags := range flags1 {
+		if elf.DynFlag1(flags)&elf.DF_1_PIE == elf.DF_1_PIE {
+			isPIE = true
+		}
+	}
+
+	soname, err := file.DynString(elf.DT_SONAME)
+	if err != nil {
+		return 0, err
+	}
+
+	// Older toolchains don't set DF_1_PIE, but a runnable file without
+	// a soname cannot be linked against.
+	if isPIE || (hasInterp && len(soname) == 0) {
+		return RecordTypeExecutable | RecordTypePIE, nil
+	}
+	if hasInterp {
+		return RecordTypeLibrary | RecordTypeExecutable, nil
+	}
+	if len(soname) == 0 {
+		return RecordTypeLibrary | RecordTypePlugin, nil
+	}
+	return RecordTypeLibrary, nil
+}
+
 // AnalyzeOne will attempt to analyze the given record, and store
 // the appropriate details for a later report.
 func (a *Report) AnalyzeOne(record *Record) error {
-	file, err := elf.Open(record.Path)
+	fi, err := os.Open(record.Path)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+	file, err := elf.NewFile(fi)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
 	// Determine if it's a shared library or executable
 	if file.FileHeader.Type == elf.ET_DYN {
-		record.Flags |= RecordTypeLibrary
+		flags, err := classifyDynamic(file)
+		if err != nil {
+			return err
+		}
+		record.Flags |= flags
 	} else if file.FileHeader.Type == elf.ET_EXEC {
 		record.Flags |= RecordTypeExecutable
 	} else {
@@ -133,8 +418,12 @@ func (a *Report) AnalyzeOne(record *Record) error {
 		return fmt.Errorf("Unknown ELF Class: %s", record.Path)
 	}
 
-	// Store the machine also
+	// Store the machine also, along with what distinguishes its ABIs
 	record.Machine = file.FileHeader.Machine
+	record.Data = file.FileHeader.Data
+	if record.ABIFlags, err = readABIFlags(fi, file); err != nil {
+		return err
+	}
 
 	// Grab the required dependencies
 	used, err := file.DynString(elf.DT_NEEDED)
@@ -144,5 +433,14 @@ func (a *Report) AnalyzeOne(record *Record) error {
 
 	record.Dependencies = used
 
+	if err = a.analyzeImports(record, file); err != nil {
+		return err
+	}
+
+	// Debug information is optional, and only of interest for the ABI
+	a.analyzeDebugLink(record, file)
+	if record.Flags&RecordTypeExport == RecordTypeExport {
+		a.analyzeDebugInfo(record, file)
+	}
 	return nil
 }
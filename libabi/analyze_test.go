@@ -0,0 +1,107 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/elf"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsExportUntyped(t *testing.T) {
+	lib := filepath.Join(t.TempDir(), "libmarkers.so.1")
+	compileFixture(t, `
+__asm__(".globl data_marker\n.data\ndata_marker: .long 0\n"
+        ".globl text_marker\n.text\ntext_marker: .long 0\n");
+int function(void) { return 0; }
+int object = 1;
+`, "-shared", "-fPIC", "-Wl,-soname,libmarkers.so.1", "-o", lib)
+
+	file, err := elf.Open(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	symbols, err := file.DynamicSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{
+		"data_marker": false,
+		"text_marker": true,
+		"function":    true,
+		"object":      true,
+	}
+	found := make(map[string]bool)
+	for _, sym := range symbols {
+		export, ok := want[sym.Name]
+		if !ok {
+			continue
+		}
+		found[sym.Name] = true
+		if got := isExport(file, sym); got != export {
+			t.Errorf("isExport(%s) = %v, want %v", sym.Name, got, export)
+		}
+	}
+	for name := range want {
+		if !found[name] {
+			t.Errorf("%s is not a dynamic symbol of the fixture", name)
+		}
+	}
+}
+
+func TestClassifyDynamic(t *testing.T) {
+	const interp = `const char interp[] __attribute__((section(".interp"))) = "/lib64/ld-linux-x86-64.so.2";` + "\n"
+	const body = "void _start(void) { for (;;) ; }\nint main(void) { return 0; }\n"
+	tests := []struct {
+		name   string
+		source string
+		args   []string
+		want   RecordType
+	}{
+		{"pie", body, []string{"-pie", "-fPIE", "-nostartfiles"}, RecordTypeExecutable | RecordTypePIE},
+		// Static PIE has DF_1_PIE, but no PT_INTERP
+		{"static-pie", body, []string{"-pie", "-fPIE", "-nostdlib", "-Wl,--no-dynamic-linker"}, RecordTypeExecutable | RecordTypePIE},
+		// Older toolchains don't set DF_1_PIE
+		{"pie without DF_1_PIE", interp + body, []string{"-shared", "-fPIC", "-nostdlib"}, RecordTypeExecutable | RecordTypePIE},
+		{"runnable library", interp + body, []string{"-shared", "-fPIC", "-nostdlib", "-Wl,-soname,libc.so.6"}, RecordTypeLibrary | RecordTypeExecutable},
+		{"library", body, []string{"-shared", "-fPIC", "-nostdlib", "-Wl,-soname,libfoo.so.1"}, RecordTypeLibrary},
+		{"plugin", body, []string{"-shared", "-fPIC", "-nostdlib"}, RecordTypeLibrary | RecordTypePlugin},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "fixture")
+			compileFixture(t, test.source, append(test.args, "-o", out)...)
+			file, err := elf.Open(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			if file.Type != elf.ET_DYN {
+				t.Fatalf("fixture is %s, want ET_DYN", file.Type)
+			}
+			got, err := classifyDynamic(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("classified as %v, want %v", got.Names(), test.want.Names())
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DebugDir is the directory, relative to the root, in which the separate
+// debug information of stripped binaries is installed, i.e. by -debuginfo
+// or -dbg packages.
+var DebugDir = "/usr/lib/debug"
+
+const (
+	// ntGNUBuildID is the note type of the GNU build-id
+	ntGNUBuildID = 3
+)
+
+// A debugIndex locates the separate debug files within the root, either by
+// the build-id they share with the stripped binary, or by the CRC recorded
+// in the .gnu_debuglink section of the stripped binary.
+type debugIndex struct {
+	files    []string          // Every debug file found
+	buildIDs map[string]string // Debug files by build-id
+
+	crcOnce sync.Once
+	crcs    map[uint32][]string // Debug files by CRC32, computed on demand
+}
+
+// parseBuildIDNote will return the GNU build-id in hex from the contents of
+// a note section, if any. Each note is a namesz, descsz and type header,
+// followed by the name and the descriptor, both padded to 4 bytes. The sizes
+// are widened before padding so that corrupt notes cannot wrap around.
+func parseBuildIDNote(data []byte, order binary.ByteOrder) (string, bool) {
+	for len(data) >= 12 {
+		namesz := uint64(order.Uint32(data[0:4]))
+		descsz := uint64(order.Uint32(data[4:8]))
+		typ := order.Uint32(data[8:12])
+		nameEnd := 12 + (namesz+3)&^3
+		descEnd := nameEnd + (descsz+3)&^3
+		if descEnd > uint64(len(data)) {
+			return "", false
+		}
+		name := data[12 : 12+namesz]
+		if typ == ntGNUBuildID && bytes.Equal(name, []byte("GNU\x00")) {
+			return hex.EncodeToString(data[nameEnd : nameEnd+descsz]), true
+		}
+		data = data[descEnd:]
+	}
+	return "", false
+}
+
+// readBuildID will return the GNU build-id of the file in hex, if any
+func readBuildID(file *elf.File) string {
+	for _, section := range file.Sections {
+		if section.Type != elf.SHT_NOTE {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			continue
+		}
+		if buildID, ok := parseBuildIDNote(data, file.ByteOrder); ok {
+			return buildID
+		}
+	}
+	return ""
+}
+
+// readDebugLink will return the file name and CRC32 recorded in the
+// .gnu_debuglink section of the file, if any.
+func readDebugLink(file *elf.File) (string, uint32, bool) {
+	section := file.Section(".gnu_debuglink")
+	if section == nil {
+		return "", 0, false
+	}
+	data, err := section.Data()
+	if err != nil {
+		return "", 0, false
+	}
+	// The name is NUL terminated and padded to 4 bytes, followed by the CRC
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return "", 0, false
+	}
+	crcOffset := (end + 4) &^ 3
+	if crcOffset+4 > len(data) {
+		return "", 0, false
+	}
+	return string(data[:end]), file.ByteOrder.Uint32(data[crcOffset:]), true
+}
+
+// fileCRC will compute the CRC32 of the file as used by .gnu_debuglink
+func fileCRC(path string) (uint32, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer fi.Close()
+	hash := crc32.NewIEEE()
+	if _, err := io.Copy(hash, fi); err != nil {
+		return 0, err
+	}
+	return hash.Sum32(), nil
+}
+
+// newDebugIndex will index every debug file found within the debug
+// directory of the root. Debug files are ELF files just like the binaries
+// they belong to, so the build-id is read from their notes rather than
+// relying on the .build-id symlinks, which may not be present.
+func newDebugIndex(root string) *debugIndex {
+	index := &debugIndex{
+		buildIDs: make(map[string]string),
+	}
+	filepath.Walk(filepath.Join(root, DebugDir), func(path string, info os.FileInfo, err error) error {
+		if info == nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if isElf, err := IsAnELF(path); err != nil || !isElf {
+			return nil
+		}
+		file, err := elf.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer file.Close()
+		index.files = append(index.files, path)
+		if buildID := readBuildID(file); buildID != "" {
+			index.buildIDs[buildID] = path
+		}
+		return nil
+	})
+	sort.Strings(index.files)
+	return index
+}
+
+// lookupDebugLink will return the debug file with the given name and CRC32,
+// as recorded in .gnu_debuglink. Like gdb, the name must match as well as the
+// CRC. As computing the CRC requires reading every debug file, this is only
+// done once the first binary without a matching build-id is encountered.
+func (d *debugIndex) lookupDebugLink(name string, crc uint32) (string, bool) {
+	d.crcOnce.Do(func() {
+		d.crcs = make(map[uint32][]string)
+		for _, path := range d.files {
+			if sum, err := fileCRC(path); err == nil {
+				d.crcs[sum] = append(d.crcs[sum], path)
+			}
+		}
+	})
+	for _, path := range d.crcs[crc] {
+		if filepath.Base(path) == name {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// analyzeDebugLink will record the build-id and .gnu_debuglink of the
+// record, along with the separate debug file that matches either of them.
+func (a *Report) analyzeDebugLink(record *Record, file *elf.File) {
+	record.BuildID = readBuildID(file)
+	record.Stripped = file.Section(".debug_info") == nil
+	if !record.Stripped || a.debug == nil {
+		return
+	}
+	if record.BuildID != "" {
+		if path, ok := a.debug.buildIDs[record.BuildID]; ok {
+			record.DebugFile = path
+			return
+		}
+	}
+	if name, crc, ok := readDebugLink(file); ok {
+		if path, ok := a.debug.lookupDebugLink(name, crc); ok {
+			record.DebugFile = path
+		}
+	}
+}
+
+// openDebugFile will return the DWARF carrying file for the record, which is
+// either the file itself, or the separate debug file found for it. The
+// returned closer must be called once the file is no longer needed.
+func openDebugFile(record *Record, file *elf.File) (*elf.File, func(), error) {
+	if !record.Stripped || record.DebugFile == "" {
+		return file, func() {}, nil
+	}
+	debugFile, err := elf.Open(record.DebugFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return debugFile, func() { debugFile.Close() }, nil
+}
+
+// CheckDebugInfo will return every stripped binary in the bucket for which
+// no separate debug file was found, sorted by path.
+func (a *Architecture) CheckDebugInfo() []*Record {
+	var ret []*Record
+	for _, record := range a.Records {
+		if record.Stripped && record.DebugFile == "" {
+			ret = append(ret, record)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret
+}
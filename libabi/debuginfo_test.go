@@ -0,0 +1,160 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// buildNote will return a note with the given header and payload, padding
+// the name and descriptor to 4 bytes.
+func buildNote(order binary.ByteOrder, namesz, descsz, typ uint32, name, desc []byte) []byte {
+	data := make([]byte, 12)
+	order.PutUint32(data[0:], namesz)
+	order.PutUint32(data[4:], descsz)
+	order.PutUint32(data[8:], typ)
+	for _, part := range [][]byte{name, desc} {
+		data = append(data, part...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	return data
+}
+
+func TestParseBuildIDNote(t *testing.T) {
+	le := binary.LittleEndian
+	gnu := []byte("GNU\x00")
+	id := []byte{0xde, 0xad, 0xbe, 0xef, 0x01}
+	buildID := buildNote(le, 4, uint32(len(id)), ntGNUBuildID, gnu, id)
+	other := buildNote(le, 4, 4, 1, gnu, []byte{1, 2, 3, 4})
+
+	tests := []struct {
+		name  string
+		order binary.ByteOrder
+		data  []byte
+		want  string
+		ok    bool
+	}{
+		{"build-id", le, buildID, "deadbeef01", true},
+		{"after another note", le, append(append([]byte{}, other...), buildID...), "deadbeef01", true},
+		{"big endian", binary.BigEndian, buildNote(binary.BigEndian, 4, 2, ntGNUBuildID, gnu, []byte{0xab, 0xcd}), "abcd", true},
+		{"empty", le, nil, "", false},
+		{"truncated header", le, buildID[:8], "", false},
+		{"truncated descriptor", le, buildID[:len(buildID)-4], "", false},
+		{"other owner", le, buildNote(le, 4, 2, ntGNUBuildID, []byte("Go\x00\x00"), []byte{1, 2}), "", false},
+		{"other type", le, other, "", false},
+		// Sizes that wrap around when padded in 32 bits
+		{"oversized name", le, buildNote(le, 0xffffffff, 0, ntGNUBuildID, gnu, nil), "", false},
+		{"oversized descriptor", le, buildNote(le, 4, 0xfffffffe, ntGNUBuildID, gnu, id), "", false},
+		{"oversized both", le, buildNote(le, 0xfffffffd, 0xfffffffd, ntGNUBuildID, nil, nil), "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := parseBuildIDNote(test.data, test.order)
+			if got != test.want || ok != test.ok {
+				t.Errorf("got %q, %v, want %q, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+// runTool will run one of the binutils, skipping the test if missing
+func runTool(t *testing.T, tool string, args ...string) {
+	t.Helper()
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		t.Skipf("%s is required to build the fixtures", tool)
+	}
+	if out, err := exec.Command(path, args...).CombinedOutput(); err != nil {
+		t.Fatalf("%s %v: %v\n%s", tool, args, err, out)
+	}
+}
+
+func TestDebugLinkName(t *testing.T) {
+	tests := []struct {
+		name  string
+		debug []string // Names of identical debug files within DebugDir
+		want  string   // Expected debug file, if any
+	}{
+		{"matching name", []string{"libfoo.so.1.debug"}, "libfoo.so.1.debug"},
+		{"renamed", []string{"libbar.so.1.debug"}, ""},
+		{"both", []string{"aaa.debug", "libfoo.so.1.debug"}, "libfoo.so.1.debug"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			libDir := filepath.Join(root, "usr", "lib64")
+			debugDir := filepath.Join(root, DebugDir, "usr", "lib64")
+			for _, dir := range []string{libDir, debugDir} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Without a build-id, only .gnu_debuglink can pair the files
+			lib := filepath.Join(libDir, "libfoo.so.1")
+			debug := filepath.Join(t.TempDir(), "libfoo.so.1.debug")
+			compileFixture(t, "int foo(void) { return 0; }\n", "-g", "-shared", "-fPIC",
+				"-Wl,--build-id=none", "-Wl,-soname,libfoo.so.1", "-o", lib)
+			runTool(t, "objcopy", "--only-keep-debug", lib, debug)
+			runTool(t, "objcopy", "--strip-debug", "--add-gnu-debuglink="+debug, lib)
+			data, err := os.ReadFile(debug)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range test.debug {
+				if err := os.WriteFile(filepath.Join(debugDir, name), data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			report, err := NewReport(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := report.Walk(); err != nil {
+				t.Fatal(err)
+			}
+			var record *Record
+			for _, arch := range report.Arches {
+				for _, r := range arch.Records {
+					if r.Name == "libfoo.so.1" {
+						record = r
+					}
+				}
+			}
+			if record == nil {
+				t.Fatal("libfoo.so.1 was not scanned")
+			}
+			if !record.Stripped {
+				t.Fatal("libfoo.so.1 was not stripped")
+			}
+			want := ""
+			if test.want != "" {
+				want = filepath.Join(debugDir, test.want)
+			}
+			if record.DebugFile != want {
+				t.Errorf("debug file %q, want %q", record.DebugFile, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ianlancetaylor/demangle"
+	"sort"
+	"strings"
+)
+
+// bareSymbolName will return the name of a symbol as written to the report
+// files, without its version and annotations.
+func bareSymbolName(symbol string) string {
+	if idx := strings.IndexAny(symbol, "@ "); idx > 0 {
+		return symbol[:idx]
+	}
+	return symbol
+}
+
+// DemangleName will return the demangled name of a C++ symbol, or of a Rust
+// symbol using either the legacy or the v0 mangling scheme. The version and
+// annotations of the symbol, if any, are ignored. An empty string is returned
+// for symbols that are not mangled.
+func DemangleName(symbol string) string {
+	name, err := demangle.ToString(bareSymbolName(symbol))
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// DisplaySymbol will return the symbol followed by a tab and its demangled
+// name, when Demangle is enabled and the symbol is mangled. Otherwise the
+// symbol is returned as is.
+func DisplaySymbol(symbol string) string {
+	if !Demangle {
+		return symbol
+	}
+	if name := DemangleName(symbol); name != "" {
+		return symbol + "\t" + name
+	}
+	return symbol
+}
+
+// demangleSonameMap will return the soname mapping with the values passed
+// through DisplaySymbol, for writing out.
+func demangleSonameMap(mapping map[string]map[string]bool) map[string]map[string]bool {
+	if !Demangle {
+		return mapping
+	}
+	ret := make(map[string]map[string]bool)
+	for soname, values := range mapping {
+		displayed := make(map[string]bool)
+		for value := range values {
+			displayed[DisplaySymbol(value)] = true
+		}
+		ret[soname] = displayed
+	}
+	return ret
+}
+
+// SymbolScope will return the namespace, class or Rust module that encloses
+// a mangled symbol, i.e. "Foo" for Foo::bar(int), or "Foo" for the vtable
+// of Foo. An empty string is returned for symbols that are not mangled or
+// are not enclosed in any scope.
+func SymbolScope(symbol string) string {
+	name, err := demangle.ToString(bareSymbolName(symbol), demangle.NoParams)
+	if err != nil {
+		return ""
+	}
+	// i.e. "vtable for Foo" or "typeinfo name for Foo"
+	if idx := strings.Index(name, " for "); idx > 0 && !strings.ContainsAny(name[:idx], ":<({") {
+		return name[idx+5:]
+	}
+	// The enclosing scope ends at the last "::" outside of any template
+	// arguments, lambda or parameter list.
+	depth := 0
+	end := -1
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '<', '(', '{', '[':
+			depth++
+		case '>', ')', '}', ']':
+			if depth > 0 {
+				depth--
+			}
+		case ':':
+			if depth == 0 && i+1 < len(name) && name[i+1] == ':' {
+				end = i
+				i++
+			}
+		}
+	}
+	if end < 0 {
+		return ""
+	}
+	return name[:end]
+}
+
+// writeSymbolChanges will write out the symbols only found on either side of
+// a comparison, each prefixed with the mark of its side. When Demangle is
+// enabled, the symbols are grouped by SymbolScope, so that a changed C++
+// method is listed next to its replacement.
+func writeSymbolChanges(b *bytes.Buffer, indent, oldMark string, oldSymbols []string, newMark string, newSymbols []string) {
+	scopeOf := func(symbol string) string {
+		if !Demangle {
+			return ""
+		}
+		return SymbolScope(symbol)
+	}
+
+	scopeSet := make(map[string]bool)
+	for _, symbol := range append(append([]string{}, oldSymbols...), newSymbols...) {
+		scopeSet[scopeOf(symbol)] = true
+	}
+	var scopes []string
+	for scope := range scopeSet {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	for _, scope := range scopes {
+		scopeIndent := indent
+		if scope != "" {
+			fmt.Fprintf(b, "%s%s:\n", indent, scope)
+			scopeIndent += "  "
+		}
+		for _, symbol := range oldSymbols {
+			if scopeOf(symbol) == scope {
+				fmt.Fprintf(b, "%s%s %s\n", scopeIndent, oldMark, DisplaySymbol(symbol))
+			}
+		}
+		for _, symbol := range newSymbols {
+			if scopeOf(symbol) == scope {
+				fmt.Fprintf(b, "%s%s %s\n", scopeIndent, newMark, DisplaySymbol(symbol))
+			}
+		}
+	}
+}
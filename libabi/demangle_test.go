@@ -0,0 +1,98 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDemangle(t *testing.T) {
+	tests := []struct {
+		symbol    string
+		demangled string
+		scope     string
+	}{
+		{"_ZN3Foo3barEi", "Foo::bar(int)", "Foo"},
+		{"_ZN3Foo3barEi@@FOO_1 [WEAK]", "Foo::bar(int)", "Foo"},
+		{"_ZN2ns5inner3Foo3bazEv", "ns::inner::Foo::baz()", "ns::inner::Foo"},
+		{"_ZTV3Foo", "vtable for Foo", "Foo"},
+		{"_ZNSt6vectorIiSaIiEE9push_backERKi", "std::vector<int, std::allocator<int> >::push_back(int const&)", "std::vector<int, std::allocator<int> >"},
+		{"_ZZ4mainENKUlvE_clEv", "main::{lambda()#1}::operator()() const", "main::{lambda()#1}"},
+		{"_Z3fooi", "foo(int)", ""},
+		// Rust legacy mangling, the hash is dropped
+		{"_ZN7mycrate3foo3bar17h0123456789abcdefE", "mycrate::foo::bar", "mycrate::foo"},
+		// Rust v0 mangling
+		{"_RNvNtCs1234_7mycrate3foo3bar", "mycrate::foo::bar", "mycrate::foo"},
+		{"_RNvCs1234_7mycrate4main", "mycrate::main", "mycrate"},
+		// Not mangled
+		{"memcpy@@GLIBC_2.14", "", ""},
+		{"_Zinvalid", "", ""},
+	}
+	for _, test := range tests {
+		if got := DemangleName(test.symbol); got != test.demangled {
+			t.Errorf("DemangleName(%s) = %q, want %q", test.symbol, got, test.demangled)
+		}
+		if got := SymbolScope(test.symbol); got != test.scope {
+			t.Errorf("SymbolScope(%s) = %q, want %q", test.symbol, got, test.scope)
+		}
+	}
+}
+
+func TestDisplaySymbol(t *testing.T) {
+	const symbol = "_ZN3Foo3barEi@@FOO_1"
+	if got := DisplaySymbol(symbol); got != symbol {
+		t.Errorf("DisplaySymbol without Demangle = %q, want %q", got, symbol)
+	}
+
+	Demangle = true
+	defer func() { Demangle = false }()
+	if got, want := DisplaySymbol(symbol), symbol+"\tFoo::bar(int)"; got != want {
+		t.Errorf("DisplaySymbol = %q, want %q", got, want)
+	}
+	if got := DisplaySymbol("memcpy@@GLIBC_2.14"); got != "memcpy@@GLIBC_2.14" {
+		t.Errorf("DisplaySymbol of a C symbol = %q", got)
+	}
+}
+
+func TestWriteSymbolChangesScopes(t *testing.T) {
+	removed := []string{"_ZN3Foo3barEi", "_ZN3Baz3quxEv", "plain"}
+	added := []string{"_ZN3Foo3barEl", "_RNvCs1234_7mycrate4main"}
+
+	var b bytes.Buffer
+	writeSymbolChanges(&b, "  ", "-", removed, "+", added)
+	want := "  - _ZN3Foo3barEi\n  - _ZN3Baz3quxEv\n  - plain\n  + _ZN3Foo3barEl\n  + _RNvCs1234_7mycrate4main\n"
+	if b.String() != want {
+		t.Errorf("without Demangle:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	Demangle = true
+	defer func() { Demangle = false }()
+	b.Reset()
+	writeSymbolChanges(&b, "  ", "-", removed, "+", added)
+	want = "  - plain\n" +
+		"  Baz:\n" +
+		"    - _ZN3Baz3quxEv\tBaz::qux()\n" +
+		"  Foo:\n" +
+		"    - _ZN3Foo3barEi\tFoo::bar(int)\n" +
+		"    + _ZN3Foo3barEl\tFoo::bar(long)\n" +
+		"  mycrate:\n" +
+		"    + _RNvCs1234_7mycrate4main\tmycrate::main\n"
+	if b.String() != want {
+		t.Errorf("with Demangle:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
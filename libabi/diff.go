@@ -0,0 +1,439 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A DiffKind classifies the overall result of comparing two reports.
+type DiffKind int
+
+const (
+	// DiffNone indicates that both reports describe the same ABI
+	DiffNone DiffKind = iota
+
+	// DiffCompatible indicates that only additions were found, which
+	// will not affect existing consumers of the ABI.
+	DiffCompatible
+
+	// DiffIncompatible indicates that ABI has been removed, and existing
+	// consumers may fail to run against the new report.
+	DiffIncompatible
+)
+
+// A SonameBump records a soname that has been replaced by a new version
+// of itself, i.e. libfoo.so.1 becoming libfoo.so.2
+type SonameBump struct {
+	Old string // The soname found in the old report
+	New string // The soname found in the new report
+}
+
+// A SymbolDiff holds the symbol changes for a single soname that exists
+// in both reports.
+type SymbolDiff struct {
+	Soname  string   // The soname these changes apply to
+	Added   []string // Symbols only found in the new report
+	Removed []string // Symbols only found in the old report
+}
+
+// A SignatureChange records an exported function whose prototype changed,
+// while keeping the same symbol.
+type SignatureChange struct {
+	Soname string // The soname exporting the function
+	Symbol string // The versioned name of the function
+	Old    string // The prototype found in the old report
+	New    string // The prototype found in the new report
+}
+
+// A TypeChange records a type used by the exported ABI whose layout changed,
+// i.e. a struct gaining a member or an enum being renumbered.
+type TypeChange struct {
+	Soname string // The soname whose ABI uses the type
+	Name   string // The name of the type, i.e. "struct foo"
+	Old    string // The layout found in the old report
+	New    string // The layout found in the new report
+}
+
+// layoutMembers will split a layout into its size and members
+func layoutMembers(layout string) []string {
+	start := strings.Index(layout, "{")
+	if start < 0 || !strings.HasSuffix(layout, "}") {
+		return nil
+	}
+	return strings.Split(layout[start+1:len(layout)-1], "; ")
+}
+
+// IsCompatible will determine whether the change only appends enumerators
+// to an enum of the same size, which existing consumers cannot observe.
+func (t *TypeChange) IsCompatible() bool {
+	if !strings.HasPrefix(t.Old, "enum {") || !strings.HasPrefix(t.New, "enum {") {
+		return false
+	}
+	oldMembers := layoutMembers(t.Old)
+	newMembers := stringSet(layoutMembers(t.New))
+	for _, member := range oldMembers {
+		if !newMembers[member] {
+			return false
+		}
+	}
+	return true
+}
+
+// An ArchitectureDiff holds all changes found between two Architecture
+// buckets for the same architecture.
+type ArchitectureDiff struct {
+	Machine        elf.Machine        // Machine both buckets were created for
+	Suffix         string             // Report suffix for the architecture
+	Added          bool               // Bucket only exists in the new report
+	Removed        bool               // Bucket only exists in the old report
+	AddedSonames   []string           // Sonames only found in the new report
+	RemovedSonames []string           // Sonames only found in the old report
+	Bumps          []SonameBump       // Sonames that changed version
+	Symbols        []*SymbolDiff      // Symbol changes within common sonames
+	Signatures     []*SignatureChange // Prototype changes of common symbols
+	Types          []*TypeChange      // Layout changes of common types
+	AddedDeps      []string           // New used_libs entries
+	RemovedDeps    []string           // Dropped used_libs entries
+}
+
+// A Diff is the result of comparing two reports, split per architecture.
+type Diff struct {
+	Arches []*ArchitectureDiff // Only contains buckets with changes
+}
+
+// sonameStem will return the unversioned portion of a soname, i.e.
+// libfoo.so for libfoo.so.1, which is used to identify soname bumps.
+func sonameStem(soname string) string {
+	if idx := strings.Index(soname, ".so"); idx > 0 {
+		return soname[:idx+3]
+	}
+	return soname
+}
+
+// exportedSonames will return the sorted sonames that export at least one
+// symbol in the bucket, mirroring what writeSymbols emits.
+func exportedSonames(bucket *Architecture) []string {
+	var sonames []string
+	for soname, symbols := range bucket.Symbols {
+		if len(symbols) > 0 {
+			sonames = append(sonames, soname)
+		}
+	}
+	sort.Strings(sonames)
+	return sonames
+}
+
+// setDifference will return the sorted members of a not present in b
+func setDifference(a, b map[string]bool) []string {
+	var ret []string
+	for key := range a {
+		if !b[key] {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// stringSet is a small helper to convert a slice into a lookup map
+func stringSet(items []string) map[string]bool {
+	ret := make(map[string]bool)
+	for _, item := range items {
+		ret[item] = true
+	}
+	return ret
+}
+
+// hasVersions will determine whether any of the symbols has a version
+func hasVersions(symbols map[string]bool) bool {
+	for key := range symbols {
+		if ParseSymbol(key).Version != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// bareSymbols will return the names of the symbols without their version
+// and annotations. Reports written before symbol versions were recorded only
+// hold the bare names, so a soname without any version in the old report is
+// compared by name alone, rather than reporting every versioned symbol of the
+// new report as a replacement.
+func bareSymbols(symbols map[string]bool) map[string]bool {
+	ret := make(map[string]bool)
+	for key := range symbols {
+		ret[ParseSymbol(key).Name] = true
+	}
+	return ret
+}
+
+// signatureMap will return the prototypes of the soname by versioned name
+func signatureMap(bucket *Architecture, soname string) map[string]string {
+	ret := make(map[string]string)
+	for value := range bucket.Signatures[soname] {
+		if idx := strings.Index(value, ":"); idx > 0 {
+			ret[value[:idx]] = value[idx+1:]
+		}
+	}
+	return ret
+}
+
+// typeMap will return the type layouts of the soname by type name
+func typeMap(bucket *Architecture, soname string) map[string]string {
+	ret := make(map[string]string)
+	for value := range bucket.Types[soname] {
+		if idx := strings.Index(value, " = "); idx > 0 {
+			ret[value[:idx]] = value[idx+3:]
+		}
+	}
+	return ret
+}
+
+// IsEmpty will determine whether any change was found for the bucket
+func (d *ArchitectureDiff) IsEmpty() bool {
+	return !d.Added && !d.Removed &&
+		len(d.AddedSonames) == 0 && len(d.RemovedSonames) == 0 &&
+		len(d.Bumps) == 0 && len(d.Symbols) == 0 && len(d.Signatures) == 0 && len(d.Types) == 0 &&
+		len(d.AddedDeps) == 0 && len(d.RemovedDeps) == 0
+}
+
+// Kind will classify the changes found within this bucket
+func (d *ArchitectureDiff) Kind() DiffKind {
+	if d.Removed || len(d.RemovedSonames) > 0 || len(d.Bumps) > 0 || len(d.Signatures) > 0 {
+		return DiffIncompatible
+	}
+	for _, sym := range d.Symbols {
+		if len(sym.Removed) > 0 {
+			return DiffIncompatible
+		}
+	}
+	for _, typ := range d.Types {
+		if !typ.IsCompatible() {
+			return DiffIncompatible
+		}
+	}
+	if d.IsEmpty() {
+		return DiffNone
+	}
+	return DiffCompatible
+}
+
+// Kind will classify the Diff as a whole, returning the most severe
+// classification of any of the architecture buckets.
+func (d *Diff) Kind() DiffKind {
+	kind := DiffNone
+	for _, arch := range d.Arches {
+		if k := arch.Kind(); k > kind {
+			kind = k
+		}
+	}
+	return kind
+}
+
+// compareArchitecture will compare two buckets for the same architecture.
+// Either of the buckets may be nil if it only exists in one report.
+func compareArchitecture(oldArch, newArch *Architecture) *ArchitectureDiff {
+	ret := &ArchitectureDiff{}
+	if oldArch == nil {
+		ret.Added = true
+		oldArch = newArch.empty()
+	} else if newArch == nil {
+		ret.Removed = true
+		newArch = oldArch.empty()
+	}
+	ret.Machine = newArch.Machine
+	ret.Suffix = newArch.GetPathSuffix()
+
+	oldSonames := stringSet(exportedSonames(oldArch))
+	newSonames := stringSet(exportedSonames(newArch))
+	added := setDifference(newSonames, oldSonames)
+	removed := setDifference(oldSonames, newSonames)
+
+	// Pair up removed sonames with an added soname of the same stem
+	bumped := make(map[string]bool)
+	for _, oldName := range removed {
+		for _, newName := range added {
+			if bumped[newName] || sonameStem(oldName) != sonameStem(newName) {
+				continue
+			}
+			ret.Bumps = append(ret.Bumps, SonameBump{Old: oldName, New: newName})
+			bumped[oldName] = true
+			bumped[newName] = true
+			break
+		}
+	}
+	for _, soname := range added {
+		if !bumped[soname] {
+			ret.AddedSonames = append(ret.AddedSonames, soname)
+		}
+	}
+	for _, soname := range removed {
+		if !bumped[soname] {
+			ret.RemovedSonames = append(ret.RemovedSonames, soname)
+		}
+	}
+
+	// Symbol changes within the sonames common to both
+	for _, soname := range exportedSonames(newArch) {
+		if !oldSonames[soname] {
+			continue
+		}
+		oldSymbols, newSymbols := oldArch.Symbols[soname], newArch.Symbols[soname]
+		if !hasVersions(oldSymbols) && hasVersions(newSymbols) {
+			oldSymbols, newSymbols = bareSymbols(oldSymbols), bareSymbols(newSymbols)
+		}
+		symDiff := &SymbolDiff{
+			Soname:  soname,
+			Added:   setDifference(newSymbols, oldSymbols),
+			Removed: setDifference(oldSymbols, newSymbols),
+		}
+		if len(symDiff.Added) > 0 || len(symDiff.Removed) > 0 {
+			ret.Symbols = append(ret.Symbols, symDiff)
+		}
+
+		// Prototypes can only be compared when both sides have them
+		oldSignatures := signatureMap(oldArch, soname)
+		newSignatures := signatureMap(newArch, soname)
+		var symbols []string
+		for symbol := range newSignatures {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+		for _, symbol := range symbols {
+			oldPrototype, ok := oldSignatures[symbol]
+			if !ok || oldPrototype == newSignatures[symbol] {
+				continue
+			}
+			ret.Signatures = append(ret.Signatures, &SignatureChange{
+				Soname: soname,
+				Symbol: symbol,
+				Old:    oldPrototype,
+				New:    newSignatures[symbol],
+			})
+		}
+
+		// Types only reachable from one side are covered by the symbols
+		oldTypes := typeMap(oldArch, soname)
+		newTypes := typeMap(newArch, soname)
+		var names []string
+		for name := range newTypes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			oldLayout, ok := oldTypes[name]
+			if !ok || oldLayout == newTypes[name] {
+				continue
+			}
+			ret.Types = append(ret.Types, &TypeChange{
+				Soname: soname,
+				Name:   name,
+				Old:    oldLayout,
+				New:    newTypes[name],
+			})
+		}
+	}
+
+	oldDeps := stringSet(oldArch.UsedLibs())
+	newDeps := stringSet(newArch.UsedLibs())
+	ret.AddedDeps = setDifference(newDeps, oldDeps)
+	ret.RemovedDeps = setDifference(oldDeps, newDeps)
+
+	return ret
+}
+
+// Compare will compare the old report with the new report, and return
+// a Diff describing every change found between them.
+func Compare(oldReport, newReport *Report) *Diff {
+	var keys []ArchitectureKey
+	for key := range oldReport.Arches {
+		keys = append(keys, key)
+	}
+	for key := range newReport.Arches {
+		if _, ok := oldReport.Arches[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Less(keys[j]) })
+
+	diff := &Diff{}
+	for _, key := range keys {
+		archDiff := compareArchitecture(oldReport.Arches[key], newReport.Arches[key])
+		if !archDiff.IsEmpty() {
+			diff.Arches = append(diff.Arches, archDiff)
+		}
+	}
+	return diff
+}
+
+// Write will emit a human readable description of the Diff to w, grouped
+// by architecture and soname.
+func (d *Diff) Write(w io.Writer) error {
+	var b bytes.Buffer
+
+	for _, arch := range d.Arches {
+		fmt.Fprintf(&b, "%s (suffix '%s')", arch.Machine, arch.Suffix)
+		if arch.Added {
+			fmt.Fprintf(&b, ": new architecture")
+		} else if arch.Removed {
+			fmt.Fprintf(&b, ": removed architecture")
+		}
+		fmt.Fprintf(&b, "\n")
+
+		for _, bump := range arch.Bumps {
+			fmt.Fprintf(&b, "  soname bump: %s -> %s\n", bump.Old, bump.New)
+		}
+		for _, soname := range arch.RemovedSonames {
+			fmt.Fprintf(&b, "  removed soname: %s\n", soname)
+		}
+		for _, soname := range arch.AddedSonames {
+			fmt.Fprintf(&b, "  added soname: %s\n", soname)
+		}
+		for _, sym := range arch.Symbols {
+			fmt.Fprintf(&b, "  %s:\n", sym.Soname)
+			writeSymbolChanges(&b, "    ", "-", sym.Removed, "+", sym.Added)
+		}
+		for _, sig := range arch.Signatures {
+			fmt.Fprintf(&b, "  signature changed: %s:%s\n", sig.Soname, DisplaySymbol(sig.Symbol))
+			fmt.Fprintf(&b, "    - %s\n", sig.Old)
+			fmt.Fprintf(&b, "    + %s\n", sig.New)
+		}
+		for _, typ := range arch.Types {
+			fmt.Fprintf(&b, "  type changed: %s:%s\n", typ.Soname, typ.Name)
+			fmt.Fprintf(&b, "    - %s\n", typ.Old)
+			fmt.Fprintf(&b, "    + %s\n", typ.New)
+		}
+		if len(arch.RemovedDeps) > 0 || len(arch.AddedDeps) > 0 {
+			fmt.Fprintf(&b, "  used_libs:\n")
+			for _, dep := range arch.RemovedDeps {
+				fmt.Fprintf(&b, "    - %s\n", dep)
+			}
+			for _, dep := range arch.AddedDeps {
+				fmt.Fprintf(&b, "    + %s\n", dep)
+			}
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,279 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// buildTestReport will return a report from lines of the form
+// suffix:file:soname:value, mirroring the report files, i.e.
+// "32:symbols:libfoo.so.1:foo" or ":used_libs::libc.so.6".
+func buildTestReport(t *testing.T, lines ...string) *Report {
+	t.Helper()
+	report := newTestReport()
+	for _, line := range lines {
+		fields := strings.SplitN(line, ":", 4)
+		if len(fields) != 4 {
+			t.Fatalf("invalid test line %q", line)
+		}
+		arch := mustArchitecture(t, fields[0])
+		bucket, ok := report.Arches[arch.Key()]
+		if !ok {
+			bucket = arch
+			report.Arches[arch.Key()] = bucket
+		}
+		soname, value := fields[2], fields[3]
+		var store map[string]map[string]bool
+		switch fields[1] {
+		case "symbols":
+			store = bucket.Symbols
+		case "signatures":
+			store = bucket.Signatures
+		case "types":
+			store = bucket.Types
+		case "used_libs":
+			bucket.Dependencies[value] = true
+			continue
+		default:
+			t.Fatalf("unknown report file %q", fields[1])
+		}
+		if store[soname] == nil {
+			store[soname] = make(map[string]bool)
+		}
+		store[soname][value] = true
+	}
+	return report
+}
+
+func TestCompare(t *testing.T) {
+	base := []string{
+		":symbols:libfoo.so.1:foo",
+		":symbols:libfoo.so.1:bar",
+		":used_libs::libc.so.6",
+	}
+	with := func(lines ...string) []string {
+		return append(append([]string{}, base...), lines...)
+	}
+
+	tests := []struct {
+		name string
+		old  []string
+		new  []string
+		kind DiffKind
+		want []string // Lines expected in the written diff
+	}{
+		{
+			name: "identical",
+			old:  base,
+			new:  base,
+			kind: DiffNone,
+		},
+		{
+			name: "added symbol",
+			old:  base,
+			new:  with(":symbols:libfoo.so.1:baz"),
+			kind: DiffCompatible,
+			want: []string{"  libfoo.so.1:", "    + baz"},
+		},
+		{
+			name: "removed symbol",
+			old:  with(":symbols:libfoo.so.1:baz"),
+			new:  base,
+			kind: DiffIncompatible,
+			want: []string{"    - baz"},
+		},
+		{
+			name: "added soname",
+			old:  base,
+			new:  with(":symbols:libbar.so.1:bar"),
+			kind: DiffCompatible,
+			want: []string{"  added soname: libbar.so.1"},
+		},
+		{
+			name: "removed soname",
+			old:  with(":symbols:libbar.so.1:bar"),
+			new:  base,
+			kind: DiffIncompatible,
+			want: []string{"  removed soname: libbar.so.1"},
+		},
+		{
+			name: "soname bump",
+			old:  base,
+			new:  []string{":symbols:libfoo.so.2:foo", ":symbols:libfoo.so.2:bar", ":used_libs::libc.so.6"},
+			kind: DiffIncompatible,
+			want: []string{"  soname bump: libfoo.so.1 -> libfoo.so.2"},
+		},
+		{
+			name: "added used_libs",
+			old:  base,
+			new:  with(":used_libs::libm.so.6"),
+			kind: DiffCompatible,
+			want: []string{"  used_libs:", "    + libm.so.6"},
+		},
+		{
+			name: "removed used_libs",
+			old:  with(":used_libs::libm.so.6"),
+			new:  base,
+			kind: DiffCompatible,
+			want: []string{"    - libm.so.6"},
+		},
+		{
+			name: "used_libs provided within the bucket",
+			old:  base,
+			new:  with(":used_libs::libfoo.so.1"),
+			kind: DiffNone,
+		},
+		{
+			name: "new architecture",
+			old:  base,
+			new:  with("32:symbols:libfoo.so.1:foo"),
+			kind: DiffCompatible,
+			want: []string{"EM_386 (suffix '32'): new architecture", "  added soname: libfoo.so.1"},
+		},
+		{
+			name: "removed architecture",
+			old:  with("32:symbols:libfoo.so.1:foo"),
+			new:  base,
+			kind: DiffIncompatible,
+			want: []string{"EM_386 (suffix '32'): removed architecture", "  removed soname: libfoo.so.1"},
+		},
+		{
+			name: "unversioned old report",
+			old:  []string{":symbols:libc.so.6:memcpy", ":symbols:libc.so.6:stdout", ":symbols:libc.so.6:gets"},
+			new:  []string{":symbols:libc.so.6:memcpy@@GLIBC_2.14", ":symbols:libc.so.6:memcpy@GLIBC_2.2.5", ":symbols:libc.so.6:stdout@@GLIBC_2.2.5 [OBJECT size=8]"},
+			kind: DiffIncompatible,
+			want: []string{"  libc.so.6:", "    - gets"},
+		},
+		{
+			name: "unversioned old report, additions",
+			old:  []string{":symbols:libc.so.6:memcpy"},
+			new:  []string{":symbols:libc.so.6:memcpy@@GLIBC_2.14", ":symbols:libc.so.6:strlcpy@@GLIBC_2.38"},
+			kind: DiffCompatible,
+			want: []string{"    + strlcpy"},
+		},
+		{
+			name: "versions removed",
+			old:  []string{":symbols:libc.so.6:memcpy@@GLIBC_2.14"},
+			new:  []string{":symbols:libc.so.6:memcpy"},
+			kind: DiffIncompatible,
+			want: []string{"    - memcpy@@GLIBC_2.14", "    + memcpy"},
+		},
+		{
+			name: "version node changed",
+			old:  []string{":symbols:libc.so.6:memcpy@@GLIBC_2.2.5"},
+			new:  []string{":symbols:libc.so.6:memcpy@@GLIBC_2.14"},
+			kind: DiffIncompatible,
+		},
+		{
+			name: "object size change",
+			old:  with(":symbols:libfoo.so.1:table [OBJECT size=16]"),
+			new:  with(":symbols:libfoo.so.1:table [OBJECT size=32]"),
+			kind: DiffIncompatible,
+			want: []string{"    - table [OBJECT size=16]", "    + table [OBJECT size=32]"},
+		},
+		{
+			name: "signature change",
+			old:  with(":signatures:libfoo.so.1:foo:int foo(int)"),
+			new:  with(":signatures:libfoo.so.1:foo:int foo(long)"),
+			kind: DiffIncompatible,
+			want: []string{"  signature changed: libfoo.so.1:foo", "    - int foo(int)", "    + int foo(long)"},
+		},
+		{
+			name: "signature only on one side",
+			old:  base,
+			new:  with(":signatures:libfoo.so.1:foo:int foo(int)"),
+			kind: DiffNone,
+		},
+		{
+			name: "enum append",
+			old:  with(":types:libfoo.so.1:enum e = enum {size=4; A=0; B=1}"),
+			new:  with(":types:libfoo.so.1:enum e = enum {size=4; A=0; B=1; C=2}"),
+			kind: DiffCompatible,
+			want: []string{"  type changed: libfoo.so.1:enum e"},
+		},
+		{
+			name: "enum renumber",
+			old:  with(":types:libfoo.so.1:enum e = enum {size=4; A=0; B=1}"),
+			new:  with(":types:libfoo.so.1:enum e = enum {size=4; A=0; C=1; B=2}"),
+			kind: DiffIncompatible,
+		},
+		{
+			name: "enum size change",
+			old:  with(":types:libfoo.so.1:enum e = enum {size=4; A=0}"),
+			new:  with(":types:libfoo.so.1:enum e = enum {size=8; A=0; B=4294967296}"),
+			kind: DiffIncompatible,
+		},
+		{
+			name: "struct size change",
+			old:  with(":types:libfoo.so.1:struct s = struct {size=8; int x@0; int y@4}"),
+			new:  with(":types:libfoo.so.1:struct s = struct {size=16; int x@0; int y@4}"),
+			kind: DiffIncompatible,
+			want: []string{"    - struct {size=8; int x@0; int y@4}"},
+		},
+		{
+			name: "struct member appended",
+			old:  with(":types:libfoo.so.1:struct s = struct {size=8; int x@0; int y@4}"),
+			new:  with(":types:libfoo.so.1:struct s = struct {size=12; int x@0; int y@4; int z@8}"),
+			kind: DiffIncompatible,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := Compare(buildTestReport(t, test.old...), buildTestReport(t, test.new...))
+			if kind := diff.Kind(); kind != test.kind {
+				t.Errorf("kind %d, want %d", kind, test.kind)
+			}
+			if test.kind == DiffNone && len(diff.Arches) != 0 {
+				t.Errorf("got %d changed architectures, want none", len(diff.Arches))
+			}
+			var b bytes.Buffer
+			if err := diff.Write(&b); err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range test.want {
+				if !strings.Contains(b.String(), line+"\n") {
+					t.Errorf("missing %q in:\n%s", line, b.String())
+				}
+			}
+		})
+	}
+}
+
+func TestTypeChangeIsCompatible(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     bool
+	}{
+		{"enum {size=4; A=0}", "enum {size=4; A=0; B=1}", true},
+		{"enum {size=4; A=0; B=1}", "enum {size=4; B=1; A=0}", true},
+		{"enum {size=4; A=0; B=1}", "enum {size=4; A=0}", false},
+		{"enum {size=4; A=0; B=1}", "enum {size=4; A=0; B=2}", false},
+		{"enum {size=4; A=0}", "enum {size=8; A=0}", false},
+		{"struct {size=4; int a@0}", "struct {size=8; int a@0; int b@4}", false},
+		{"enum {size=4; A=0}", "struct {size=4; int a@0}", false},
+	}
+	for _, test := range tests {
+		change := &TypeChange{Old: test.old, New: test.new}
+		if got := change.IsCompatible(); got != test.want {
+			t.Errorf("%s -> %s: compatible %v, want %v", test.old, test.new, got, test.want)
+		}
+	}
+}
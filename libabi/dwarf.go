@@ -0,0 +1,419 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"strings"
+)
+
+// maxOriginDepth limits how many DW_AT_abstract_origin and
+// DW_AT_specification references are followed for a single entry.
+const maxOriginDepth = 8
+
+// A debugInfo wraps the DWARF data of a record, along with an index of the
+// out-of-line function definitions and global variables found within it.
+type debugInfo struct {
+	data      *dwarf.Data
+	bigEndian bool                    // Byte order of the record
+	functions map[uint64]dwarf.Offset // Function definitions by address
+	names     map[string]dwarf.Offset // Function definitions by linkage name
+	variables map[string]dwarf.Offset // Global variable definitions by linkage name
+	scopes    map[dwarf.Offset]string // Enclosing C++ scope of nested types, i.e. "ns::Outer::"
+}
+
+// entryAt will read the entry at the given offset
+func (d *debugInfo) entryAt(off dwarf.Offset) (*dwarf.Entry, error) {
+	reader := d.data.Reader()
+	reader.Seek(off)
+	return reader.Next()
+}
+
+// children will return the direct children of the entry at the given offset
+// that have the given tag.
+func (d *debugInfo) children(off dwarf.Offset, tag dwarf.Tag) []*dwarf.Entry {
+	reader := d.data.Reader()
+	reader.Seek(off)
+	entry, err := reader.Next()
+	if err != nil || entry == nil || !entry.Children {
+		return nil
+	}
+	var ret []*dwarf.Entry
+	for {
+		child, err := reader.Next()
+		if err != nil || child == nil || child.Tag == 0 {
+			return ret
+		}
+		if child.Tag == tag {
+			ret = append(ret, child)
+		}
+		if child.Children {
+			reader.SkipChildren()
+		}
+	}
+}
+
+// origins will return the entry followed by every entry it refers to via
+// DW_AT_abstract_origin or DW_AT_specification, where the declaration of a
+// function may be found.
+func (d *debugInfo) origins(entry *dwarf.Entry) []*dwarf.Entry {
+	ret := []*dwarf.Entry{entry}
+	for i := 0; i < maxOriginDepth; i++ {
+		off, ok := entry.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			if off, ok = entry.Val(dwarf.AttrSpecification).(dwarf.Offset); !ok {
+				break
+			}
+		}
+		next, err := d.entryAt(off)
+		if err != nil || next == nil {
+			break
+		}
+		ret = append(ret, next)
+		entry = next
+	}
+	return ret
+}
+
+// attr will return the first value of the attribute along the origins
+func (d *debugInfo) attr(entry *dwarf.Entry, attr dwarf.Attr) interface{} {
+	for _, origin := range d.origins(entry) {
+		if val := origin.Val(attr); val != nil {
+			return val
+		}
+	}
+	return nil
+}
+
+// isTypeTag will determine if the tag defines a named type that may be
+// nested within a C++ namespace or class.
+func isTypeTag(tag dwarf.Tag) bool {
+	switch tag {
+	case dwarf.TagStructType, dwarf.TagClassType, dwarf.TagUnionType,
+		dwarf.TagEnumerationType, dwarf.TagTypedef:
+		return true
+	}
+	return false
+}
+
+// scopeName will return the name the entry contributes to the qualified
+// name of the types nested within it, if any.
+func scopeName(entry *dwarf.Entry) string {
+	switch entry.Tag {
+	case dwarf.TagNamespace:
+		if name, ok := entry.Val(dwarf.AttrName).(string); ok {
+			return name + "::"
+		}
+		return "(anonymous namespace)::"
+	case dwarf.TagStructType, dwarf.TagClassType, dwarf.TagUnionType:
+		if name, ok := entry.Val(dwarf.AttrName).(string); ok {
+			return name + "::"
+		}
+	}
+	return ""
+}
+
+// newDebugInfo will index every function definition and global variable
+// within the DWARF data, along with the scope of every nested type.
+func newDebugInfo(data *dwarf.Data, order elf.Data) (*debugInfo, error) {
+	d := &debugInfo{
+		data:      data,
+		bigEndian: order == elf.ELFDATA2MSB,
+		functions: make(map[uint64]dwarf.Offset),
+		names:     make(map[string]dwarf.Offset),
+		variables: make(map[string]dwarf.Offset),
+		scopes:    make(map[dwarf.Offset]string),
+	}
+	// The enclosing scopes of the current entry, outermost first
+	var scopes []string
+	reader := data.Reader()
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag == 0 {
+			if len(scopes) > 0 {
+				scopes = scopes[:len(scopes)-1]
+			}
+			continue
+		}
+		if isTypeTag(entry.Tag) {
+			if scope := strings.Join(scopes, ""); scope != "" {
+				d.scopes[entry.Offset] = scope
+			}
+		}
+		if entry.Children {
+			scopes = append(scopes, scopeName(entry))
+		}
+		if entry.Tag == dwarf.TagVariable {
+			d.indexVariable(entry)
+			continue
+		}
+		if entry.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		entrypc, ok := d.entryPC(entry)
+		if !ok {
+			continue
+		}
+		d.functions[entrypc] = entry.Offset
+		for _, attr := range []dwarf.Attr{dwarf.AttrLinkageName, dwarf.AttrName} {
+			if name, ok := d.attr(entry, attr).(string); ok {
+				d.names[name] = entry.Offset
+				break
+			}
+		}
+	}
+	return d, nil
+}
+
+// entryPC will return the address a function definition is entered at.
+// Functions split into hot and cold parts by the compiler have a list of
+// address ranges rather than a low address, the first of which holds the
+// entry point unless it is given explicitly.
+func (d *debugInfo) entryPC(entry *dwarf.Entry) (uint64, bool) {
+	if lowpc, ok := entry.Val(dwarf.AttrLowpc).(uint64); ok {
+		return lowpc, true
+	}
+	if field := entry.AttrField(dwarf.AttrEntrypc); field != nil && field.Class == dwarf.ClassAddress {
+		if entrypc, ok := field.Val.(uint64); ok {
+			return entrypc, true
+		}
+	}
+	if entry.Val(dwarf.AttrRanges) == nil {
+		return 0, false
+	}
+	ranges, err := d.data.Ranges(entry)
+	if err != nil || len(ranges) == 0 {
+		return 0, false
+	}
+	return ranges[0][0], true
+}
+
+// indexVariable will index the variable entry if it defines a global
+// variable, which may be exported as a data object.
+func (d *debugInfo) indexVariable(entry *dwarf.Entry) {
+	if entry.Val(dwarf.AttrLocation) == nil {
+		return
+	}
+	if external, _ := d.attr(entry, dwarf.AttrExternal).(bool); !external {
+		return
+	}
+	for _, attr := range []dwarf.Attr{dwarf.AttrLinkageName, dwarf.AttrName} {
+		if name, ok := d.attr(entry, attr).(string); ok {
+			d.variables[name] = entry.Offset
+			return
+		}
+	}
+}
+
+// cTypeName will return the name of the type as written in C, as the names
+// provided by debug/dwarf use Go's pointer and array notation.
+func cTypeName(typ dwarf.Type) string {
+	return qualifiedTypeName(typ, nil)
+}
+
+// qualifiedTypeName will return the name of the type as written in C, using
+// the names given for any of the types it refers to instead, such as the
+// qualified names of C++ types.
+func qualifiedTypeName(typ dwarf.Type, names map[dwarf.Type]string) string {
+	if name, ok := names[typ]; ok {
+		return name
+	}
+	switch t := typ.(type) {
+	case nil, *dwarf.VoidType:
+		return "void"
+	case *dwarf.PtrType:
+		if fn, ok := t.Type.(*dwarf.FuncType); ok {
+			return qualifiedTypeName(fn.ReturnType, names) + " (*)(" + cParamNames(fn, names) + ")"
+		}
+		return qualifiedTypeName(t.Type, names) + " *"
+	case *dwarf.QualType:
+		if _, ok := t.Type.(*dwarf.PtrType); ok {
+			return qualifiedTypeName(t.Type, names) + t.Qual
+		}
+		return t.Qual + " " + qualifiedTypeName(t.Type, names)
+	case *dwarf.ArrayType:
+		if t.Count < 0 {
+			return qualifiedTypeName(t.Type, names) + "[]"
+		}
+		return fmt.Sprintf("%s[%d]", qualifiedTypeName(t.Type, names), t.Count)
+	case *dwarf.FuncType:
+		return qualifiedTypeName(t.ReturnType, names) + " (" + cParamNames(t, names) + ")"
+	case *dwarf.StructType:
+		if t.StructName == "" {
+			return t.Kind + " {...}"
+		}
+		return t.Kind + " " + t.StructName
+	case *dwarf.EnumType:
+		if t.EnumName == "" {
+			return "enum {...}"
+		}
+		return "enum " + t.EnumName
+	case *dwarf.TypedefType:
+		return t.Name
+	default:
+		return typ.String()
+	}
+}
+
+// cParamNames will return the parameter list of a function type
+func cParamNames(fn *dwarf.FuncType, names map[dwarf.Type]string) string {
+	if len(fn.ParamType) == 0 {
+		return "void"
+	}
+	var params []string
+	for _, param := range fn.ParamType {
+		if _, ok := param.(*dwarf.DotDotDotType); ok {
+			params = append(params, "...")
+		} else {
+			params = append(params, qualifiedTypeName(param, names))
+		}
+	}
+	return strings.Join(params, ", ")
+}
+
+// typeName will return the C name of the type at the given offset
+func (d *debugInfo) typeName(off dwarf.Offset) (string, error) {
+	typ, err := d.data.Type(off)
+	if err != nil {
+		return "", err
+	}
+	return cTypeName(typ), nil
+}
+
+// prototype will return the prototype of the function definition at the
+// given offset, using the given name, i.e. "int foo(const char *, ...)".
+func (d *debugInfo) prototype(name string, off dwarf.Offset) (string, error) {
+	reader := d.data.Reader()
+	reader.Seek(off)
+	entry, err := reader.Next()
+	if err != nil {
+		return "", err
+	}
+
+	ret := "void"
+	if typeOff, ok := d.attr(entry, dwarf.AttrType).(dwarf.Offset); ok {
+		if ret, err = d.typeName(typeOff); err != nil {
+			return "", err
+		}
+	}
+
+	var params []string
+	for entry.Children {
+		child, err := reader.Next()
+		if err != nil {
+			return "", err
+		}
+		if child == nil || child.Tag == 0 {
+			break
+		}
+		switch child.Tag {
+		case dwarf.TagFormalParameter:
+			// The implicit this pointer of C++ methods
+			if artificial, _ := d.attr(child, dwarf.AttrArtificial).(bool); artificial {
+				break
+			}
+			typeOff, ok := d.attr(child, dwarf.AttrType).(dwarf.Offset)
+			if !ok {
+				break
+			}
+			param, err := d.typeName(typeOff)
+			if err != nil {
+				return "", err
+			}
+			params = append(params, param)
+		case dwarf.TagUnspecifiedParameters:
+			params = append(params, "...")
+		}
+		if child.Children {
+			reader.SkipChildren()
+		}
+	}
+	if len(params) == 0 {
+		params = []string{"void"}
+	}
+	if !strings.HasSuffix(ret, "*") {
+		ret += " "
+	}
+	return ret + name + "(" + strings.Join(params, ", ") + ")", nil
+}
+
+// function will return the definition of the exported function, if any
+func (d *debugInfo) function(symbol *Symbol) (dwarf.Offset, bool) {
+	// Versioned aliases share an address, but not a name. The
+	// address of an IFUNC symbol is that of its resolver.
+	off, ok := d.functions[symbol.Value]
+	if !ok || symbol.Type == sttGNUIFunc {
+		off, ok = d.names[symbol.Name]
+	}
+	return off, ok
+}
+
+// analyzeSignatures will record the prototype of every exported function
+// of the record that has a definition within the debug information.
+func (d *debugInfo) analyzeSignatures(record *Record) {
+	for _, symbol := range record.Symbols {
+		if symbol.Type != elf.STT_FUNC && symbol.Type != sttGNUIFunc {
+			continue
+		}
+		off, ok := d.function(symbol)
+		if !ok {
+			continue
+		}
+		prototype, err := d.prototype(symbol.Name, off)
+		if err != nil {
+			continue
+		}
+		if record.Signatures == nil {
+			record.Signatures = make(map[string]string)
+		}
+		record.Signatures[symbol.VersionedName()] = prototype
+	}
+}
+
+// analyzeDebugInfo will examine the DWARF debug information of the record,
+// or of its separate debug file, and record the prototypes of its exported
+// functions and the layout of the types they use. Debug information is
+// optional, so any failure to read it is not an error and simply leaves the
+// record without it.
+func (a *Report) analyzeDebugInfo(record *Record, file *elf.File) {
+	file, closer, err := openDebugFile(record, file)
+	if err != nil {
+		return
+	}
+	defer closer()
+	if file.Section(".debug_info") == nil {
+		return
+	}
+	data, err := file.DWARF()
+	if err != nil {
+		return
+	}
+	d, err := newDebugInfo(data, file.Data)
+	if err != nil {
+		return
+	}
+	d.analyzeSignatures(record)
+	d.analyzeLayouts(record)
+}
@@ -0,0 +1,105 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// hasRanges will determine if the named subprogram of the file is described
+// by DW_AT_ranges rather than DW_AT_low_pc.
+func hasRanges(t *testing.T, path, name string) bool {
+	t.Helper()
+	file, err := elf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := file.DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := data.Reader()
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil {
+			return false
+		}
+		if entry.Tag == dwarf.TagSubprogram && entry.Val(dwarf.AttrName) == name {
+			return entry.Val(dwarf.AttrRanges) != nil
+		}
+	}
+}
+
+func TestSignaturesSplitFunction(t *testing.T) {
+	root := t.TempDir()
+	libDir := filepath.Join(root, "usr", "lib64")
+	if err := os.MkdirAll(libDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	lib := filepath.Join(libDir, "libsplit.so.1")
+	// The unlikely branch is moved to split_func.cold, leaving the
+	// function with two address ranges
+	compileFixture(t, `
+extern void report(const char *, int) __attribute__((cold));
+int split_func(int x, int y) {
+	int r = 0;
+	for (int i = 0; i < y; i++) {
+		if (__builtin_expect(x > 100 + i, 0)) {
+			report("first", x);
+			report("second", y);
+			r += x * y;
+			continue;
+		}
+		r += x * i;
+	}
+	return r;
+}
+`, "-g", "-O2", "-shared", "-fPIC", "-Wl,-soname,libsplit.so.1", "-o", lib)
+	if !hasRanges(t, lib, "split_func") {
+		t.Skip("the compiler did not split the function")
+	}
+
+	report, err := NewReport(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Walk(); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, arch := range report.Arches {
+		for _, record := range arch.Records {
+			if prototype, ok := record.Signatures["split_func"]; ok {
+				found = true
+				if prototype != "int split_func(int, int)" {
+					t.Errorf("prototype %q", prototype)
+				}
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no signature recorded for split_func")
+	}
+}
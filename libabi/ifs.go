@@ -0,0 +1,146 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ifsVersion is the version of the LLVM interface stub format we emit
+const ifsVersion = "3.0"
+
+// ifsArch will return the architecture name of the bucket as understood by
+// llvm-ifs, which is the lower case ELF machine name, i.e. x86_64 or aarch64.
+func ifsArch(bucket *Architecture) string {
+	return strings.ToLower(strings.TrimPrefix(bucket.Machine.String(), "EM_"))
+}
+
+// ifsType will return the IFS symbol type of the symbol
+func ifsType(symbol *Symbol) string {
+	switch symbol.Type {
+	case elf.STT_FUNC, sttGNUIFunc:
+		return "Func"
+	case elf.STT_OBJECT, elf.STT_COMMON:
+		return "Object"
+	case elf.STT_TLS:
+		return "TLS"
+	case elf.STT_NOTYPE:
+		return "NoType"
+	default:
+		return "Unknown"
+	}
+}
+
+// ifsString will quote the string if it cannot be used as a plain YAML
+// scalar.
+func ifsString(s string) string {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '$') {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// WriteIFS will write an LLVM interface stub (IFS) for the exported soname
+// to w, which llvm-ifs can turn into a stub library to link against.
+//
+// Stubs have no notion of symbol versions, so only the default version of
+// each symbol is listed, and compat symbols are omitted.
+func (a *Architecture) WriteIFS(w io.Writer, soname string) error {
+	var b bytes.Buffer
+
+	endianness := "little"
+	if a.Data == elf.ELFDATA2MSB {
+		endianness = "big"
+	}
+	bitWidth := 64
+	if a.Class == elf.ELFCLASS32 {
+		bitWidth = 32
+	}
+
+	fmt.Fprintf(&b, "--- !ifs-v1\n")
+	fmt.Fprintf(&b, "IfsVersion: %s\n", ifsVersion)
+	fmt.Fprintf(&b, "SoName: %s\n", ifsString(soname))
+	fmt.Fprintf(&b, "Target: { ObjectFormat: ELF, Arch: %s, Endianness: %s, BitWidth: %d }\n",
+		ifsArch(a), endianness, bitWidth)
+
+	if record := a.exportedRecord(soname); record != nil && len(record.Dependencies) > 0 {
+		fmt.Fprintf(&b, "NeededLibs:\n")
+		for _, dep := range record.Dependencies {
+			fmt.Fprintf(&b, "  - %s\n", ifsString(dep))
+		}
+	}
+
+	fmt.Fprintf(&b, "Symbols:\n")
+	seen := make(map[string]bool)
+	for _, symbol := range a.exportedSymbols(soname) {
+		if symbol.Hidden || seen[symbol.Name] {
+			continue
+		}
+		// Version nodes are only meaningful to the versioning machinery
+		if symbol.Name == symbol.Version && symbol.Size == 0 {
+			continue
+		}
+		seen[symbol.Name] = true
+
+		fields := []string{
+			"Name: " + ifsString(symbol.Name),
+			"Type: " + ifsType(symbol),
+		}
+		if _, ok := sizedTypes[symbol.Type]; ok {
+			fields = append(fields, fmt.Sprintf("Size: %d", symbol.Size))
+		}
+		if symbol.Binding == elf.STB_WEAK {
+			fields = append(fields, "Weak: true")
+		}
+		fmt.Fprintf(&b, "  - { %s }\n", strings.Join(fields, ", "))
+	}
+	fmt.Fprintf(&b, "...\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// ReportIFS will write an interface stub for every exported soname of the
+// bucket into the ReportOutputDir, within a directory named using the given
+// prefix and the suffix of the bucket, i.e. ifs32/libz.so.1.ifs
+func (a *Report) ReportIFS(prefix string, bucket *Architecture) error {
+	dir := filepath.Join(ReportOutputDir, fmt.Sprintf("%sifs%s", prefix, bucket.GetPathSuffix()))
+	if err := os.MkdirAll(dir, 00755); err != nil {
+		return err
+	}
+	for _, soname := range exportedSonames(bucket) {
+		fi, err := os.Create(filepath.Join(dir, soname+".ifs"))
+		if err != nil {
+			return err
+		}
+		err = bucket.WriteIFS(fi, soname)
+		fi.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// JSONSchemaVersion is the version of the JSON report format. It is bumped
+// whenever a field is removed or changes meaning, while new fields may be
+// added at any time.
+const JSONSchemaVersion = 1
+
+// A JSONReport is the top level object of the JSON report format
+type JSONReport struct {
+	Schema        int                 `json:"schema"`             // JSONSchemaVersion
+	Version       string              `json:"abireport_version"`  // Version of abireport
+	Timestamp     string              `json:"timestamp"`          // RFC 3339 time of the scan
+	Root          string              `json:"root"`               // Scanned root directory, empty for packages
+	Packages      []string            `json:"packages,omitempty"` // Scanned packages, if any
+	Architectures []*JSONArchitecture `json:"architectures"`      // Sorted by machine
+}
+
+// A JSONArchitecture holds the aggregated data of one Architecture, as
+// written to the text report files, along with every record within it.
+type JSONArchitecture struct {
+	Machine     string              `json:"machine"`      // i.e. EM_X86_64
+	Class       string              `json:"class"`        // i.e. ELFCLASS64
+	Data        string              `json:"data"`         // i.e. ELFDATA2LSB
+	Suffix      string              `json:"suffix"`       // Suffix of the text report files
+	Symbols     map[string][]string `json:"symbols"`      // The symbols file
+	Versions    map[string][]string `json:"versions"`     // The versions file
+	Signatures  map[string][]string `json:"signatures"`   // The signatures file
+	Types       map[string][]string `json:"types"`        // The types file
+	UsedLibs    []string            `json:"used_libs"`    // The used_libs file
+	UsedSymbols map[string][]string `json:"used_symbols"` // The used_symbols file
+	Counts      *JSONCounts         `json:"counts"`       // Number of records of each kind
+	Records     []*JSONRecord       `json:"records"`      // Sorted by path
+}
+
+// A JSONCounts holds the number of records of each kind in an architecture.
+// Executables and shared objects count every record once, while the others
+// are subsets of them.
+type JSONCounts struct {
+	Executables   int `json:"executables"`    // Including PIE
+	PIE           int `json:"pie"`            // Position independent executables
+	SharedObjects int `json:"shared_objects"` // Including runnable and plugins
+	Runnable      int `json:"runnable"`       // Shared objects that can be run
+	Plugins       int `json:"plugins"`        // Shared objects without a soname
+}
+
+// A JSONRecord describes a single file found in the scan
+type JSONRecord struct {
+	Path         string            `json:"path"`                 // Install path within the root
+	Name         string            `json:"name"`                 // Soname or basename
+	Flags        []string          `json:"flags"`                // RecordType names
+	Machine      string            `json:"machine"`              // i.e. EM_X86_64
+	Variant      string            `json:"variant,omitempty"`    // Optimized variant subdirectory
+	Dependencies []string          `json:"dependencies"`         // DT_NEEDED entries
+	Symbols      []*JSONSymbol     `json:"symbols"`              // Exported symbols
+	Signatures   map[string]string `json:"signatures,omitempty"` // Function prototypes
+	Types        map[string]string `json:"types,omitempty"`      // Type layouts
+	BuildID      string            `json:"build_id,omitempty"`   // GNU build-id in hex
+	Stripped     bool              `json:"stripped,omitempty"`   // No debug information within
+	DebugFile    string            `json:"debug_file,omitempty"` // Separate debug file
+	Package      string            `json:"package,omitempty"`    // Package providing the file
+}
+
+// A JSONSymbol describes a single exported symbol
+type JSONSymbol struct {
+	Name       string `json:"name"`
+	Version    string `json:"version,omitempty"`
+	Hidden     bool   `json:"hidden,omitempty"` // Not the default version
+	Binding    string `json:"binding"`          // i.e. STB_GLOBAL
+	Type       string `json:"type"`             // i.e. STT_FUNC
+	Visibility string `json:"visibility"`       // i.e. STV_DEFAULT
+	Size       uint64 `json:"size,omitempty"`
+	Demangled  string `json:"demangled,omitempty"` // Only set with Demangle
+}
+
+// sortedSonameMap will convert a soname mapping into sorted lists
+func sortedSonameMap(mapping map[string]map[string]bool) map[string][]string {
+	ret := make(map[string][]string)
+	for soname, values := range mapping {
+		list := []string{}
+		for value := range values {
+			list = append(list, value)
+		}
+		sort.Strings(list)
+		ret[soname] = list
+	}
+	return ret
+}
+
+// jsonBinding will return the name of the binding, including GNU extensions
+func jsonBinding(bind elf.SymBind) string {
+	if bind == stbGNUUnique {
+		return "STB_GNU_UNIQUE"
+	}
+	return bind.String()
+}
+
+// jsonType will return the name of the type, including GNU extensions
+func jsonType(typ elf.SymType) string {
+	if typ == sttGNUIFunc {
+		return "STT_GNU_IFUNC"
+	}
+	return typ.String()
+}
+
+// jsonDemangled will return the demangled name of the symbol, if enabled
+func jsonDemangled(name string) string {
+	if !Demangle {
+		return ""
+	}
+	return DemangleName(name)
+}
+
+// newJSONRecord will convert the record for the JSON report
+func (a *Report) newJSONRecord(record *Record) *JSONRecord {
+	ret := &JSONRecord{
+		Path:         a.InstallPath(record),
+		Name:         record.Name,
+		Flags:        record.Flags.Names(),
+		Machine:      record.Machine.String(),
+		Variant:      record.Variant,
+		Dependencies: append([]string{}, record.Dependencies...),
+		Symbols:      []*JSONSymbol{},
+		Signatures:   record.Signatures,
+		Types:        record.Types,
+		BuildID:      record.BuildID,
+		Stripped:     record.Stripped,
+		DebugFile:    a.DebugPath(record),
+		Package:      record.Package,
+	}
+	for _, symbol := range record.Symbols {
+		ret.Symbols = append(ret.Symbols, &JSONSymbol{
+			Name:       symbol.Name,
+			Version:    symbol.Version,
+			Hidden:     symbol.Hidden,
+			Binding:    jsonBinding(symbol.Binding),
+			Type:       jsonType(symbol.Type),
+			Visibility: symbol.Visibility.String(),
+			Size:       symbol.Size,
+			Demangled:  jsonDemangled(symbol.Name),
+		})
+	}
+	sort.Slice(ret.Symbols, func(i, j int) bool {
+		return ret.Symbols[i].Name+"@"+ret.Symbols[i].Version < ret.Symbols[j].Name+"@"+ret.Symbols[j].Version
+	})
+	return ret
+}
+
+// newJSONArchitecture will convert the bucket for the JSON report
+func (a *Report) newJSONArchitecture(bucket *Architecture) *JSONArchitecture {
+	counts := bucket.Counts()
+	ret := &JSONArchitecture{
+		Machine:     bucket.Machine.String(),
+		Class:       bucket.Class.String(),
+		Data:        bucket.Data.String(),
+		Suffix:      bucket.GetPathSuffix(),
+		Symbols:     sortedSonameMap(bucket.Symbols),
+		Versions:    sortedSonameMap(bucket.Versions),
+		Signatures:  sortedSonameMap(bucket.Signatures),
+		Types:       sortedSonameMap(bucket.Types),
+		UsedLibs:    append([]string{}, bucket.UsedLibs()...),
+		UsedSymbols: sortedSonameMap(bucket.UsedSymbols()),
+		Counts: &JSONCounts{
+			Executables:   counts.Executables,
+			PIE:           counts.PIE,
+			SharedObjects: counts.SharedObjects,
+			Runnable:      counts.Runnable,
+			Plugins:       counts.Plugins,
+		},
+		Records: []*JSONRecord{},
+	}
+	for _, record := range bucket.Records {
+		ret.Records = append(ret.Records, a.newJSONRecord(record))
+	}
+	sort.Slice(ret.Records, func(i, j int) bool { return ret.Records[i].Path < ret.Records[j].Path })
+	return ret
+}
+
+// JSON will return the complete report in the JSON report format. The
+// version is that of abireport itself, and when is the time of the scan.
+func (a *Report) JSON(version string, when time.Time) *JSONReport {
+	ret := &JSONReport{
+		Schema:        JSONSchemaVersion,
+		Version:       version,
+		Timestamp:     when.UTC().Format(time.RFC3339),
+		Root:          a.Root,
+		Architectures: []*JSONArchitecture{},
+	}
+	// Exploded packages live in a temporary root that no longer exists
+	if len(a.Packages) > 0 {
+		ret.Root = ""
+		ret.Packages = append([]string{}, a.Packages...)
+		sort.Strings(ret.Packages)
+	}
+
+	for _, bucket := range a.SortedArches() {
+		ret.Architectures = append(ret.Architectures, a.newJSONArchitecture(bucket))
+	}
+	return ret
+}
+
+// WriteJSON will write the complete report to w in the JSON report format
+func (a *Report) WriteJSON(w io.Writer, version string, when time.Time) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a.JSON(version, when))
+}
+
+// ReportJSON will write the complete report in the JSON report format into
+// the ReportOutputDir, using the given prefix.
+func (a *Report) ReportJSON(prefix, version string, when time.Time) error {
+	fi, err := os.Create(filepath.Join(ReportOutputDir, fmt.Sprintf("%sreport.json", prefix)))
+	if err != nil {
+		return err
+	}
+	if err = a.WriteJSON(fi, version, when); err != nil {
+		fi.Close()
+		return err
+	}
+	return fi.Close()
+}
@@ -0,0 +1,189 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newJSONTestReport will return a report whose buckets, records and symbols
+// are all stored out of order.
+func newJSONTestReport(t *testing.T, root string) *Report {
+	t.Helper()
+	primary := mustArchitecture(t, "")
+	secondary := mustArchitecture(t, "32")
+	aarch64 := mustArchitecture(t, "aarch64")
+
+	primary.Records = []*Record{
+		{
+			Path:  filepath.Join(root, "usr/lib64/libfoo.so.1"),
+			Name:  "libfoo.so.1",
+			Flags: RecordTypeLibrary | RecordTypeExport | RecordType64bit,
+			Symbols: []*Symbol{
+				{Name: "foo_unique", Version: "FOO_1", Binding: stbGNUUnique, Type: elf.STT_OBJECT, Visibility: elf.STV_DEFAULT, Size: 4},
+				{Name: "foo_ifunc", Version: "FOO_1", Binding: elf.STB_GLOBAL, Type: sttGNUIFunc, Visibility: elf.STV_DEFAULT},
+				{Name: "foo", Version: "FOO_1", Hidden: true, Binding: elf.STB_WEAK, Type: elf.STT_FUNC, Visibility: elf.STV_PROTECTED},
+				{Name: "foo", Version: "FOO_2", Binding: elf.STB_GLOBAL, Type: elf.STT_FUNC, Visibility: elf.STV_DEFAULT},
+			},
+			Machine: elf.EM_X86_64,
+		},
+		{
+			Path:         filepath.Join(root, "usr/bin/foo"),
+			Name:         "foo",
+			Flags:        RecordTypeExecutable | RecordTypePIE | RecordType64bit,
+			Dependencies: []string{"libfoo.so.1", "libc.so.6"},
+			Machine:      elf.EM_X86_64,
+		},
+	}
+	primary.Dependencies["libfoo.so.1"] = true
+	primary.Dependencies["libc.so.6"] = true
+	addSymbols(primary, "libfoo.so.1", "foo@@FOO_2", "foo@FOO_1 [WEAK PROTECTED]", "foo_ifunc@@FOO_1 [IFUNC]")
+	secondary.Records = []*Record{
+		{Path: filepath.Join(root, "usr/lib32/libfoo.so.1"), Name: "libfoo.so.1", Flags: RecordTypeLibrary | RecordType32bit, Machine: elf.EM_386},
+	}
+	aarch64.Records = []*Record{
+		{Path: filepath.Join(root, "usr/lib64/plugin.so"), Name: "plugin.so", Flags: RecordTypeLibrary | RecordTypePlugin | RecordType64bit, Machine: elf.EM_AARCH64},
+	}
+
+	report := newTestReport(aarch64, secondary, primary)
+	report.Root = root
+	return report
+}
+
+// decodeJSON will write the report as JSON and decode it again
+func decodeJSON(t *testing.T, report *Report, when time.Time) *JSONReport {
+	t.Helper()
+	var b bytes.Buffer
+	if err := report.WriteJSON(&b, "1.2.3", when); err != nil {
+		t.Fatalf("cannot write JSON: %v", err)
+	}
+	var ret JSONReport
+	if err := json.Unmarshal(b.Bytes(), &ret); err != nil {
+		t.Fatalf("cannot decode JSON: %v\n%s", err, b.String())
+	}
+	return &ret
+}
+
+func TestWriteJSON(t *testing.T) {
+	root := "/tmp/root"
+	when := time.Date(2017, 3, 4, 5, 6, 7, 0, time.FixedZone("CET", 3600))
+	got := decodeJSON(t, newJSONTestReport(t, root), when)
+
+	if got.Schema != JSONSchemaVersion || got.Version != "1.2.3" || got.Root != root || got.Packages != nil {
+		t.Errorf("header %d %q %q %v", got.Schema, got.Version, got.Root, got.Packages)
+	}
+	if got.Timestamp != "2017-03-04T04:06:07Z" {
+		t.Errorf("timestamp %q", got.Timestamp)
+	}
+
+	var machines []string
+	for _, arch := range got.Architectures {
+		machines = append(machines, arch.Suffix+":"+arch.Machine)
+	}
+	if want := []string{"32:EM_386", ":EM_X86_64", "aarch64:EM_AARCH64"}; !reflect.DeepEqual(machines, want) {
+		t.Fatalf("architectures %v, want %v", machines, want)
+	}
+
+	primary := got.Architectures[1]
+	if primary.Class != "ELFCLASS64" || primary.Data != "ELFDATA2LSB" {
+		t.Errorf("class %s, data %s", primary.Class, primary.Data)
+	}
+	if want := []string{"foo@@FOO_2", "foo@FOO_1 [WEAK PROTECTED]", "foo_ifunc@@FOO_1 [IFUNC]"}; !reflect.DeepEqual(primary.Symbols["libfoo.so.1"], want) {
+		t.Errorf("symbols %v, want %v", primary.Symbols["libfoo.so.1"], want)
+	}
+	// Only the dependencies not provided by the bucket itself
+	if want := []string{"libc.so.6"}; !reflect.DeepEqual(primary.UsedLibs, want) {
+		t.Errorf("used_libs %v, want %v", primary.UsedLibs, want)
+	}
+	if want := (JSONCounts{Executables: 1, PIE: 1, SharedObjects: 1}); primary.Counts == nil || *primary.Counts != want {
+		t.Errorf("counts %+v, want %+v", primary.Counts, want)
+	}
+	if want := (JSONCounts{SharedObjects: 1, Plugins: 1}); *got.Architectures[2].Counts != want {
+		t.Errorf("aarch64 counts %+v, want %+v", got.Architectures[2].Counts, want)
+	}
+
+	if len(primary.Records) != 2 {
+		t.Fatalf("got %d records, want 2", len(primary.Records))
+	}
+	exe, lib := primary.Records[0], primary.Records[1]
+	if exe.Path != "/usr/bin/foo" || lib.Path != "/usr/lib64/libfoo.so.1" {
+		t.Fatalf("records %s, %s are not sorted by install path", exe.Path, lib.Path)
+	}
+	if want := []string{"executable", "64bit", "pie"}; !reflect.DeepEqual(exe.Flags, want) {
+		t.Errorf("flags %v, want %v", exe.Flags, want)
+	}
+	if exe.Symbols == nil || len(exe.Symbols) != 0 {
+		t.Errorf("executable symbols %v, want an empty list", exe.Symbols)
+	}
+
+	want := []*JSONSymbol{
+		{Name: "foo", Version: "FOO_1", Hidden: true, Binding: "STB_WEAK", Type: "STT_FUNC", Visibility: "STV_PROTECTED"},
+		{Name: "foo", Version: "FOO_2", Binding: "STB_GLOBAL", Type: "STT_FUNC", Visibility: "STV_DEFAULT"},
+		{Name: "foo_ifunc", Version: "FOO_1", Binding: "STB_GLOBAL", Type: "STT_GNU_IFUNC", Visibility: "STV_DEFAULT"},
+		{Name: "foo_unique", Version: "FOO_1", Binding: "STB_GNU_UNIQUE", Type: "STT_OBJECT", Visibility: "STV_DEFAULT", Size: 4},
+	}
+	if !reflect.DeepEqual(lib.Symbols, want) {
+		for _, symbol := range lib.Symbols {
+			t.Logf("%+v", symbol)
+		}
+		t.Errorf("symbols are not sorted or named as expected")
+	}
+}
+
+func TestWriteJSONPackages(t *testing.T) {
+	report := newJSONTestReport(t, "/tmp/exploded")
+	report.Packages = []string{"libfoo-32bit-1.0-1.x86_64.rpm", "libfoo-1.0-1.x86_64.rpm"}
+	got := decodeJSON(t, report, time.Now())
+	if got.Root != "" {
+		t.Errorf("root %q, want none for packages", got.Root)
+	}
+	if want := []string{"libfoo-1.0-1.x86_64.rpm", "libfoo-32bit-1.0-1.x86_64.rpm"}; !reflect.DeepEqual(got.Packages, want) {
+		t.Errorf("packages %v, want %v", got.Packages, want)
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	dir := t.TempDir()
+	withOutputDir(t, dir)
+	report := newJSONTestReport(t, "/tmp/root")
+	if err := report.ReportJSON("test-", "1.2.3", time.Now()); err != nil {
+		t.Fatalf("cannot write report: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "test-report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got JSONReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("cannot decode report: %v", err)
+	}
+	if len(got.Architectures) != 3 {
+		t.Errorf("got %d architectures, want 3", len(got.Architectures))
+	}
+
+	withOutputDir(t, filepath.Join(dir, "missing"))
+	if err := report.ReportJSON("test-", "1.2.3", time.Now()); err == nil {
+		t.Errorf("expected an error writing into a missing directory")
+	}
+}
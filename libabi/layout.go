@@ -0,0 +1,412 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"strings"
+)
+
+// typeKinds maps the tags of the types with a layout to the keyword they
+// are declared with.
+var typeKinds = map[dwarf.Tag]string{
+	dwarf.TagStructType:      "struct",
+	dwarf.TagClassType:       "class",
+	dwarf.TagUnionType:       "union",
+	dwarf.TagEnumerationType: "enum",
+}
+
+// scope will return the enclosing C++ scope of a type, i.e. "ns::Outer::".
+// Types defined outside of the namespace they were declared in refer to
+// their declaration with DW_AT_specification.
+func (d *debugInfo) scope(entry *dwarf.Entry) string {
+	if scope, ok := d.scopes[entry.Offset]; ok {
+		return scope
+	}
+	if off, ok := entry.Val(dwarf.AttrSpecification).(dwarf.Offset); ok {
+		return d.scopes[off]
+	}
+	return ""
+}
+
+// memberOffset will return the byte offset of a member, which DWARF 2
+// producers encode as a DW_OP_plus_uconst location expression.
+func memberOffset(entry *dwarf.Entry) int64 {
+	switch loc := entry.Val(dwarf.AttrDataMemberLoc).(type) {
+	case int64:
+		return loc
+	case []byte:
+		const opPlusUconst = 0x23
+		if len(loc) < 2 || loc[0] != opPlusUconst {
+			return 0
+		}
+		var ret int64
+		for i, b := range loc[1:] {
+			ret |= int64(b&0x7f) << (7 * uint(i))
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		return ret
+	}
+	return 0
+}
+
+// bitPosition will return the offset in bits of a bitfield member from the
+// start of the enclosing type. DWARF 4 and later describe it directly with
+// DW_AT_data_bit_offset, while DWARF 2 and 3 use DW_AT_bit_offset, which
+// counts from the most significant bit of the storage unit at the member's
+// byte offset.
+func (d *debugInfo) bitPosition(member *dwarf.Entry, byteOffset, bitSize int64, typ dwarf.Type) int64 {
+	if dataBitOffset, ok := member.Val(dwarf.AttrDataBitOffset).(int64); ok {
+		return byteOffset*8 + dataBitOffset
+	}
+	bitOffset, _ := member.Val(dwarf.AttrBitOffset).(int64)
+	if d.bigEndian {
+		return byteOffset*8 + bitOffset
+	}
+	size, ok := member.Val(dwarf.AttrByteSize).(int64)
+	if !ok {
+		size = typ.Size()
+	}
+	return byteOffset*8 + size*8 - bitOffset - bitSize
+}
+
+// A layoutWalker collects the layout of every named struct, union, class
+// and enum reachable from a set of types. Types are visited by their DWARF
+// offset, as the layout depends on attributes that debug/dwarf doesn't
+// preserve, such as the encoding of bitfields and the enclosing scope.
+type layoutWalker struct {
+	d       *debugInfo
+	seen    map[dwarf.Offset]bool
+	named   map[dwarf.Offset]bool
+	names   map[dwarf.Type]string // Qualified names, and names of references
+	layouts map[string]string     // Type layouts by name
+}
+
+// typeAt will return the entry and the type at the given offset
+func (w *layoutWalker) typeAt(off dwarf.Offset) (*dwarf.Entry, dwarf.Type, error) {
+	entry, err := w.d.entryAt(off)
+	if err != nil {
+		return nil, nil, err
+	}
+	if entry == nil {
+		return nil, nil, fmt.Errorf("no entry at offset %d", off)
+	}
+	typ, err := w.d.data.Type(off)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, typ, nil
+}
+
+// isAnonymous will determine whether the entry is a struct, union, class or
+// enum without a name, which can only be described by its layout.
+func (w *layoutWalker) isAnonymous(entry *dwarf.Entry) bool {
+	if _, ok := typeKinds[entry.Tag]; !ok {
+		return false
+	}
+	name, _ := w.d.attr(entry, dwarf.AttrName).(string)
+	return name == ""
+}
+
+// nameTypes will record the qualified name of the type at the given offset,
+// and of every type its name is composed of, for use by qualifiedTypeName.
+// C++ references are named after the type they refer to, as debug/dwarf
+// doesn't support them.
+func (w *layoutWalker) nameTypes(off dwarf.Offset) {
+	if w.named[off] {
+		return
+	}
+	w.named[off] = true
+	entry, typ, err := w.typeAt(off)
+	if err != nil {
+		return
+	}
+	target, hasTarget := entry.Val(dwarf.AttrType).(dwarf.Offset)
+
+	switch entry.Tag {
+	case dwarf.TagStructType, dwarf.TagClassType, dwarf.TagUnionType, dwarf.TagEnumerationType, dwarf.TagTypedef:
+		// The name may only be found on the declaration
+		name, _ := w.d.attr(entry, dwarf.AttrName).(string)
+		if name == "" {
+			return
+		}
+		if kind, ok := typeKinds[entry.Tag]; ok {
+			name = kind + " " + w.d.scope(entry) + name
+		} else {
+			name = w.d.scope(entry) + name
+		}
+		if name != cTypeName(typ) {
+			w.names[typ] = name
+		}
+	case dwarf.TagPointerType, dwarf.TagConstType, dwarf.TagVolatileType, dwarf.TagRestrictType, dwarf.TagArrayType:
+		if hasTarget {
+			w.nameTypes(target)
+		}
+	case dwarf.TagReferenceType, dwarf.TagRvalueReferenceType:
+		name := "void"
+		if hasTarget {
+			w.nameTypes(target)
+			if targetType, err := w.d.data.Type(target); err == nil {
+				name = qualifiedTypeName(targetType, w.names)
+			}
+		}
+		if entry.Tag == dwarf.TagReferenceType {
+			w.names[typ] = name + " &"
+		} else {
+			w.names[typ] = name + " &&"
+		}
+	case dwarf.TagSubroutineType:
+		if hasTarget {
+			w.nameTypes(target)
+		}
+		for _, param := range w.d.children(off, dwarf.TagFormalParameter) {
+			if paramType, ok := param.Val(dwarf.AttrType).(dwarf.Offset); ok {
+				w.nameTypes(paramType)
+			}
+		}
+	}
+}
+
+// typeName will return the qualified C name of the type at the given offset
+func (w *layoutWalker) typeName(off dwarf.Offset) string {
+	w.nameTypes(off)
+	typ, err := w.d.data.Type(off)
+	if err != nil {
+		return "?"
+	}
+	return qualifiedTypeName(typ, w.names)
+}
+
+// fieldTypeName will return the type of a member, describing anonymous
+// types by their layout as they have no name to refer to.
+func (w *layoutWalker) fieldTypeName(off dwarf.Offset) string {
+	if entry, err := w.d.entryAt(off); err == nil && entry != nil && w.isAnonymous(entry) {
+		return w.typeLayout(off)
+	}
+	return w.typeName(off)
+}
+
+// typeLayout will describe the size and members of a struct, union or class,
+// or the size and enumerators of an enum, i.e.
+// "struct {size=8; int x@0; int y@4}" or "enum {size=4; RED=0; GREEN=1}".
+// Bitfields are described by their byte, bit and width, i.e. "int f@4.3:1".
+func (w *layoutWalker) typeLayout(off dwarf.Offset) string {
+	entry, typ, err := w.typeAt(off)
+	if err != nil {
+		return "?"
+	}
+	kind, ok := typeKinds[entry.Tag]
+	if !ok {
+		return w.typeName(off)
+	}
+
+	members := []string{fmt.Sprintf("size=%d", typ.Size())}
+	if entry.Tag == dwarf.TagEnumerationType {
+		for _, enumerator := range w.d.children(off, dwarf.TagEnumerator) {
+			name, _ := enumerator.Val(dwarf.AttrName).(string)
+			switch val := enumerator.Val(dwarf.AttrConstValue).(type) {
+			case int64:
+				members = append(members, fmt.Sprintf("%s=%d", name, val))
+			case uint64:
+				members = append(members, fmt.Sprintf("%s=%d", name, val))
+			}
+		}
+		return kind + " {" + strings.Join(members, "; ") + "}"
+	}
+
+	for _, field := range w.d.children(off, dwarf.TagMember) {
+		// Static data members of C++ classes take no space
+		if declaration, _ := field.Val(dwarf.AttrDeclaration).(bool); declaration {
+			continue
+		}
+		fieldType, ok := field.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			continue
+		}
+		member := w.fieldTypeName(fieldType)
+		if name, ok := field.Val(dwarf.AttrName).(string); ok && name != "" {
+			member += " " + name
+		}
+		byteOffset := memberOffset(field)
+		if bitSize, _ := field.Val(dwarf.AttrBitSize).(int64); bitSize > 0 {
+			fieldTyp, err := w.d.data.Type(fieldType)
+			if err != nil {
+				continue
+			}
+			pos := w.d.bitPosition(field, byteOffset, bitSize, fieldTyp)
+			member += fmt.Sprintf("@%d.%d:%d", pos/8, pos%8, bitSize)
+		} else {
+			member += fmt.Sprintf("@%d", byteOffset)
+		}
+		members = append(members, member)
+	}
+	return kind + " {" + strings.Join(members, "; ") + "}"
+}
+
+// walk will record the layout of the type at the given offset if it has
+// one, and visit every type it refers to.
+func (w *layoutWalker) walk(off dwarf.Offset) {
+	if w.seen[off] {
+		return
+	}
+	w.seen[off] = true
+	entry, err := w.d.entryAt(off)
+	if err != nil || entry == nil {
+		return
+	}
+	target, hasTarget := entry.Val(dwarf.AttrType).(dwarf.Offset)
+
+	switch entry.Tag {
+	case dwarf.TagPointerType, dwarf.TagConstType, dwarf.TagVolatileType, dwarf.TagRestrictType,
+		dwarf.TagArrayType, dwarf.TagReferenceType, dwarf.TagRvalueReferenceType:
+		if hasTarget {
+			w.walk(target)
+		}
+	case dwarf.TagSubroutineType:
+		if hasTarget {
+			w.walk(target)
+		}
+		for _, param := range w.d.children(off, dwarf.TagFormalParameter) {
+			if paramType, ok := param.Val(dwarf.AttrType).(dwarf.Offset); ok {
+				w.walk(paramType)
+			}
+		}
+	case dwarf.TagTypedef:
+		if !hasTarget {
+			return
+		}
+		// i.e. typedef struct { ... } foo_t;
+		if targetEntry, err := w.d.entryAt(target); err == nil && targetEntry != nil &&
+			w.isAnonymous(targetEntry) && !isDeclaration(targetEntry) {
+			w.layouts[w.typeName(off)] = w.typeLayout(target)
+		}
+		w.walk(target)
+	case dwarf.TagStructType, dwarf.TagClassType, dwarf.TagUnionType:
+		// Opaque types are not part of the ABI
+		if isDeclaration(entry) {
+			return
+		}
+		if !w.isAnonymous(entry) {
+			w.layouts[w.typeName(off)] = w.typeLayout(off)
+		}
+		for _, field := range w.d.children(off, dwarf.TagMember) {
+			if fieldType, ok := field.Val(dwarf.AttrType).(dwarf.Offset); ok {
+				w.walk(fieldType)
+			}
+		}
+	case dwarf.TagEnumerationType:
+		if !w.isAnonymous(entry) && !isDeclaration(entry) {
+			w.layouts[w.typeName(off)] = w.typeLayout(off)
+		}
+	}
+}
+
+// isDeclaration will determine whether the entry only declares a type
+func isDeclaration(entry *dwarf.Entry) bool {
+	declaration, _ := entry.Val(dwarf.AttrDeclaration).(bool)
+	return declaration
+}
+
+// functionTypes will return the return and parameter types of the function
+// definition at the given offset.
+func (d *debugInfo) functionTypes(off dwarf.Offset) ([]dwarf.Offset, error) {
+	reader := d.data.Reader()
+	reader.Seek(off)
+	entry, err := reader.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []dwarf.Offset
+	if typeOff, ok := d.attr(entry, dwarf.AttrType).(dwarf.Offset); ok {
+		ret = append(ret, typeOff)
+	}
+	for entry.Children {
+		child, err := reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if child == nil || child.Tag == 0 {
+			break
+		}
+		if child.Tag == dwarf.TagFormalParameter {
+			if typeOff, ok := d.attr(child, dwarf.AttrType).(dwarf.Offset); ok {
+				ret = append(ret, typeOff)
+			}
+		}
+		if child.Children {
+			reader.SkipChildren()
+		}
+	}
+	return ret, nil
+}
+
+// variableType will return the type of the variable definition at the
+// given offset.
+func (d *debugInfo) variableType(off dwarf.Offset) ([]dwarf.Offset, error) {
+	entry, err := d.entryAt(off)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	if typeOff, ok := d.attr(entry, dwarf.AttrType).(dwarf.Offset); ok {
+		return []dwarf.Offset{typeOff}, nil
+	}
+	return nil, nil
+}
+
+// analyzeLayouts will record the layout of every named type reachable from
+// the exported functions and data objects of the record.
+func (d *debugInfo) analyzeLayouts(record *Record) {
+	w := &layoutWalker{
+		d:       d,
+		seen:    make(map[dwarf.Offset]bool),
+		named:   make(map[dwarf.Offset]bool),
+		names:   make(map[dwarf.Type]string),
+		layouts: make(map[string]string),
+	}
+	for _, symbol := range record.Symbols {
+		var roots []dwarf.Offset
+		var err error
+		switch symbol.Type {
+		case elf.STT_FUNC, sttGNUIFunc:
+			off, ok := d.function(symbol)
+			if !ok {
+				continue
+			}
+			roots, err = d.functionTypes(off)
+		case elf.STT_OBJECT, elf.STT_TLS:
+			off, ok := d.variables[symbol.Name]
+			if !ok {
+				continue
+			}
+			roots, err = d.variableType(off)
+		}
+		if err != nil {
+			continue
+		}
+		for _, root := range roots {
+			w.walk(root)
+		}
+	}
+	if len(w.layouts) > 0 {
+		record.Types = w.layouts
+	}
+}
@@ -0,0 +1,111 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// scanLayouts will scan the library built by build within a new root, and
+// return the layouts recorded for it.
+func scanLayouts(t *testing.T, build func(lib string)) map[string]string {
+	t.Helper()
+	root := t.TempDir()
+	libDir := filepath.Join(root, "usr", "lib64")
+	if err := os.MkdirAll(libDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	build(filepath.Join(libDir, "liblayout.so.1"))
+
+	report, err := NewReport(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Walk(); err != nil {
+		t.Fatal(err)
+	}
+	for _, arch := range report.Arches {
+		for _, record := range arch.Records {
+			if record.Name == "liblayout.so.1" {
+				return record.Types
+			}
+		}
+	}
+	t.Fatalf("liblayout.so.1 was not scanned")
+	return nil
+}
+
+func TestLayoutBitfields(t *testing.T) {
+	const source = `
+struct flags { unsigned a:31; unsigned b:1; };
+struct mixed { char c; unsigned x:3; unsigned :0; unsigned short y:9; unsigned z:1; };
+int use(struct flags *f, struct mixed *m) { return f->b + m->y; }
+`
+	want := map[string]string{
+		"struct flags": "struct {size=4; unsigned int a@0.0:31; unsigned int b@3.7:1}",
+		"struct mixed": "struct {size=8; char c@0; unsigned int x@1.0:3; short unsigned int y@4.0:9; unsigned int z@5.1:1}",
+	}
+
+	// DWARF 4 uses DW_AT_bit_offset, and DWARF 5 DW_AT_data_bit_offset
+	for _, version := range []string{"-gdwarf-4", "-gdwarf-5"} {
+		t.Run(version, func(t *testing.T) {
+			got := scanLayouts(t, func(lib string) {
+				compileFixture(t, source, version, "-shared", "-fPIC", "-Wl,-soname,liblayout.so.1", "-o", lib)
+			})
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLayoutCxxScopes(t *testing.T) {
+	const source = `
+namespace ns {
+struct Inner { int x; };
+class Outer {
+public:
+	struct Nested { long y; };
+	Nested n;
+	int z;
+	static int count;
+};
+namespace {
+struct Hidden { char h; };
+}
+struct Declared;
+}
+struct ns::Declared { ns::Inner *inner; };
+int ns::Outer::count;
+int take(const ns::Outer &o, ns::Inner &&i, ns::Declared &d) { return o.z + i.x + d.inner->x; }
+`
+	got := scanLayouts(t, func(lib string) {
+		compileWith(t, "g++", "fixture.cc", source, "-g", "-shared", "-fPIC", "-Wl,-soname,liblayout.so.1", "-o", lib)
+	})
+	want := map[string]string{
+		"struct ns::Inner":         "struct {size=4; int x@0}",
+		"class ns::Outer":          "class {size=16; struct ns::Outer::Nested n@0; int z@8}",
+		"struct ns::Outer::Nested": "struct {size=8; long int y@0}",
+		"struct ns::Declared":      "struct {size=8; struct ns::Inner * inner@0}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,334 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// ldSoCache is the location of the dynamic loader cache
+	ldSoCache = "/etc/ld.so.cache"
+
+	// Magic strings identifying the glibc cache formats
+	ldCacheMagicOld = "ld.so-1.7.0"
+	ldCacheMagicNew = "glibc-ld.so.cache1.1"
+
+	// Sizes of the headers and entries of each format
+	ldCacheHeaderOld = 16
+	ldCacheEntryOld  = 12
+	ldCacheHeaderNew = 48
+	ldCacheEntryNew  = 24
+
+	// ldCacheBigEndian is set in the flags of a big endian new cache
+	ldCacheBigEndian = 3
+
+	// ldCacheExtensionMagic identifies the new format extension directory
+	ldCacheExtensionMagic = 0xeaa42174
+
+	// ldCacheTagHWCaps is the extension section for glibc-hwcaps names
+	ldCacheTagHWCaps = 1
+
+	// ldCacheHWCapExtension marks an hwcap value as a glibc-hwcaps index
+	ldCacheHWCapExtension = uint64(1) << 62
+)
+
+// A LdCacheEntry is a single library registered in the ld.so.cache
+type LdCacheEntry struct {
+	Flags     int32  // Library type and architecture flags
+	Soname    string // Name the library is looked up by
+	Path      string // Location of the library
+	OSVersion uint32 // Required OS version, if any (new format only)
+	HWCap     uint64 // Legacy hwcap mask (new format only)
+	HWCaps    string // glibc-hwcaps subdirectory name, if any
+}
+
+// A LdCache is the parsed contents of an ld.so.cache file
+type LdCache struct {
+	Format  string          // Magic string of the format that was parsed
+	Entries []*LdCacheEntry // All entries in the order they're stored
+}
+
+// cString will return the NUL terminated string at the offset in data
+func cString(data []byte, offset uint32) (string, error) {
+	if uint64(offset) >= uint64(len(data)) {
+		return "", fmt.Errorf("string offset %d out of range", offset)
+	}
+	end := bytes.IndexByte(data[offset:], 0)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string at offset %d", offset)
+	}
+	return string(data[offset : offset+uint32(end)]), nil
+}
+
+// parseLdCacheNew will parse the glibc-ld.so.cache1.1 format beginning at
+// data, which is either the start of the file or follows an old format
+// cache. All string offsets are relative to the start of this header.
+func parseLdCacheNew(data []byte) (*LdCache, error) {
+	if len(data) < ldCacheHeaderNew {
+		return nil, fmt.Errorf("truncated ld.so.cache header")
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if data[28]&ldCacheBigEndian == ldCacheBigEndian {
+		order = binary.BigEndian
+	}
+
+	nlibs := order.Uint32(data[20:24])
+	extOffset := order.Uint32(data[32:36])
+	if uint64(ldCacheHeaderNew)+uint64(nlibs)*ldCacheEntryNew > uint64(len(data)) {
+		return nil, fmt.Errorf("truncated ld.so.cache entries")
+	}
+
+	// Look up the glibc-hwcaps subdirectory names, if any
+	var hwcaps []uint32
+	if extOffset != 0 && uint64(extOffset)+8 <= uint64(len(data)) &&
+		order.Uint32(data[extOffset:]) == ldCacheExtensionMagic {
+		count := order.Uint32(data[extOffset+4:])
+		for i := uint32(0); i < count; i++ {
+			sec := uint64(extOffset) + 8 + uint64(i)*16
+			if sec+16 > uint64(len(data)) {
+				return nil, fmt.Errorf("truncated ld.so.cache extension")
+			}
+			if order.Uint32(data[sec:]) != ldCacheTagHWCaps {
+				continue
+			}
+			offset := order.Uint32(data[sec+8:])
+			size := order.Uint32(data[sec+12:])
+			if uint64(offset)+uint64(size) > uint64(len(data)) {
+				return nil, fmt.Errorf("truncated ld.so.cache hwcaps section")
+			}
+			for j := uint32(0); j+4 <= size; j += 4 {
+				hwcaps = append(hwcaps, order.Uint32(data[offset+j:]))
+			}
+		}
+	}
+
+	cache := &LdCache{Format: ldCacheMagicNew}
+	for i := uint32(0); i < nlibs; i++ {
+		entry := data[ldCacheHeaderNew+i*ldCacheEntryNew:]
+		soname, err := cString(data, order.Uint32(entry[4:8]))
+		if err != nil {
+			return nil, err
+		}
+		path, err := cString(data, order.Uint32(entry[8:12]))
+		if err != nil {
+			return nil, err
+		}
+		e := &LdCacheEntry{
+			Flags:     int32(order.Uint32(entry[0:4])),
+			Soname:    soname,
+			Path:      path,
+			OSVersion: order.Uint32(entry[12:16]),
+			HWCap:     order.Uint64(entry[16:24]),
+		}
+		if e.HWCap&ldCacheHWCapExtension == ldCacheHWCapExtension {
+			index := uint32(e.HWCap)
+			if index >= uint32(len(hwcaps)) {
+				return nil, fmt.Errorf("invalid glibc-hwcaps index %d", index)
+			}
+			if e.HWCaps, err = cString(data, hwcaps[index]); err != nil {
+				return nil, err
+			}
+		}
+		cache.Entries = append(cache.Entries, e)
+	}
+	return cache, nil
+}
+
+// ParseLdCache will parse the contents of an ld.so.cache file in either the
+// old ld.so-1.7.0 format, the new glibc-ld.so.cache1.1 format, or the
+// combined format where the new format follows the old one.
+func ParseLdCache(data []byte) (*LdCache, error) {
+	if bytes.HasPrefix(data, []byte(ldCacheMagicNew)) {
+		return parseLdCacheNew(data)
+	}
+	if !bytes.HasPrefix(data, []byte(ldCacheMagicOld)) {
+		return nil, fmt.Errorf("unknown ld.so.cache format")
+	}
+	if len(data) < ldCacheHeaderOld {
+		return nil, fmt.Errorf("truncated ld.so.cache header")
+	}
+
+	// The old format is always in host byte order, as are the offsets
+	order := binary.LittleEndian
+	nlibs := order.Uint32(data[12:16])
+	strTable := uint64(ldCacheHeaderOld) + uint64(nlibs)*ldCacheEntryOld
+	if strTable > uint64(len(data)) {
+		return nil, fmt.Errorf("truncated ld.so.cache entries")
+	}
+
+	// Prefer the new format when both are present, aligned to 8 bytes
+	newStart := (strTable + 7) &^ 7
+	if newStart < uint64(len(data)) && bytes.HasPrefix(data[newStart:], []byte(ldCacheMagicNew)) {
+		return parseLdCacheNew(data[newStart:])
+	}
+
+	cache := &LdCache{Format: ldCacheMagicOld}
+	strTab := data[strTable:]
+	for i := uint64(0); i < uint64(nlibs); i++ {
+		entry := data[ldCacheHeaderOld+i*ldCacheEntryOld:]
+		soname, err := cString(strTab, order.Uint32(entry[4:8]))
+		if err != nil {
+			return nil, err
+		}
+		path, err := cString(strTab, order.Uint32(entry[8:12]))
+		if err != nil {
+			return nil, err
+		}
+		cache.Entries = append(cache.Entries, &LdCacheEntry{
+			Flags:  int32(order.Uint32(entry[0:4])),
+			Soname: soname,
+			Path:   path,
+		})
+	}
+	return cache, nil
+}
+
+// LoadLdCache will parse the /etc/ld.so.cache file within the root of the
+// Resolver.
+func (r *Resolver) LoadLdCache() (*LdCache, error) {
+	real, err := r.RealPath(ldSoCache)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(r.hostPath(real))
+	if err != nil {
+		return nil, err
+	}
+	return ParseLdCache(data)
+}
+
+// A LdCacheProblemKind identifies the type of an LdCacheProblem
+type LdCacheProblemKind int
+
+const (
+	// LdCacheStale is an entry pointing to a file that doesn't exist
+	LdCacheStale LdCacheProblemKind = iota
+
+	// LdCacheMissing is a library that ldconfig would have cached, but is
+	// not present in the cache.
+	LdCacheMissing
+)
+
+// A LdCacheProblem is a single mismatch between the cache and the root
+type LdCacheProblem struct {
+	Kind   LdCacheProblemKind // The type of problem
+	Soname string             // Name the library is, or should be, cached by
+	Path   string             // Location of the library within the root
+	HWCaps string             // glibc-hwcaps subdirectory name, if any
+}
+
+// hwcapsDir will split a path into the library directory and the name of
+// the glibc-hwcaps subdirectory it lives in, if any.
+func hwcapsDir(path string) (string, string) {
+	dir := filepath.Dir(path)
+	parent := filepath.Dir(dir)
+	if filepath.Base(parent) == "glibc-hwcaps" {
+		return filepath.Dir(parent), filepath.Base(dir)
+	}
+	return dir, ""
+}
+
+// isCacheableName will determine if ldconfig would cache the file name
+func isCacheableName(name string) bool {
+	return (strings.HasPrefix(name, "lib") || strings.HasPrefix(name, "ld-")) &&
+		strings.Contains(name, ".so")
+}
+
+// CheckLdCache will compare the cache with the libraries found by the
+// report, which must have been walked over the same root as the Resolver.
+// Entries pointing to files that don't exist are reported as stale, and any
+// library within a cached directory (or its glibc-hwcaps subdirectories)
+// that has no matching entry is reported as missing.
+func (r *Resolver) CheckLdCache(cache *LdCache, report *Report) []*LdCacheProblem {
+	var ret []*LdCacheProblem
+
+	// Compare directories after resolving links, i.e. for merged /usr
+	realDir := func(dir string) string {
+		if real, err := r.RealPath(dir); err == nil {
+			return real
+		}
+		return dir
+	}
+
+	// Directories ldconfig would scan, and the entries it produced
+	cachedDirs := make(map[string]bool)
+	for _, dir := range r.LibDirs {
+		cachedDirs[realDir(dir)] = true
+	}
+	for _, dir := range trustedLibDirs() {
+		cachedDirs[realDir(dir)] = true
+	}
+	cached := make(map[string]bool)
+	for _, entry := range cache.Entries {
+		dir, hwcaps := hwcapsDir(entry.Path)
+		dir = realDir(dir)
+		cachedDirs[dir] = true
+		cached[entry.Soname+"\x00"+dir+"\x00"+hwcaps] = true
+
+		if _, err := r.RealPath(entry.Path); err != nil {
+			ret = append(ret, &LdCacheProblem{
+				Kind:   LdCacheStale,
+				Soname: entry.Soname,
+				Path:   entry.Path,
+				HWCaps: entry.HWCaps,
+			})
+		}
+	}
+
+	for _, arch := range report.Arches {
+		for _, record := range arch.Records {
+			if record.Flags&RecordTypeLibrary != RecordTypeLibrary {
+				continue
+			}
+			rel, err := filepath.Rel(r.Root, record.Path)
+			if err != nil {
+				continue
+			}
+			path := filepath.Join("/", rel)
+			if !isCacheableName(filepath.Base(path)) {
+				continue
+			}
+			dir, hwcaps := hwcapsDir(path)
+			dir = realDir(dir)
+			if !cachedDirs[dir] || cached[record.Name+"\x00"+dir+"\x00"+hwcaps] {
+				continue
+			}
+			ret = append(ret, &LdCacheProblem{
+				Kind:   LdCacheMissing,
+				Soname: record.Name,
+				Path:   path,
+				HWCaps: hwcaps,
+			})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Kind != ret[j].Kind {
+			return ret[i].Kind < ret[j].Kind
+		}
+		return ret[i].Path < ret[j].Path
+	})
+	return ret
+}
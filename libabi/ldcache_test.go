@@ -0,0 +1,259 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testCacheEntry is an entry to be written by buildLdCacheOld/New
+type testCacheEntry struct {
+	flags  uint32
+	soname string
+	path   string
+	hwcap  uint64
+}
+
+// buildLdCacheOld will return an ld.so-1.7.0 cache of the entries
+func buildLdCacheOld(entries []testCacheEntry) []byte {
+	order := binary.LittleEndian
+	data := make([]byte, ldCacheHeaderOld+len(entries)*ldCacheEntryOld)
+	copy(data, ldCacheMagicOld)
+	order.PutUint32(data[12:], uint32(len(entries)))
+
+	var strs []byte
+	for i, entry := range entries {
+		e := data[ldCacheHeaderOld+i*ldCacheEntryOld:]
+		order.PutUint32(e[0:], entry.flags)
+		order.PutUint32(e[4:], uint32(len(strs)))
+		strs = append(strs, entry.soname+"\x00"...)
+		order.PutUint32(e[8:], uint32(len(strs)))
+		strs = append(strs, entry.path+"\x00"...)
+	}
+	return append(data, strs...)
+}
+
+// buildLdCacheNew will return a glibc-ld.so.cache1.1 cache of the entries
+// in the given byte order, with a glibc-hwcaps extension for the names.
+func buildLdCacheNew(order binary.ByteOrder, entries []testCacheEntry, hwcaps []string) []byte {
+	data := make([]byte, ldCacheHeaderNew+len(entries)*ldCacheEntryNew)
+	copy(data, ldCacheMagicNew)
+	order.PutUint32(data[20:], uint32(len(entries)))
+	if order == binary.ByteOrder(binary.BigEndian) {
+		data[28] = ldCacheBigEndian
+	} else {
+		data[28] = 2
+	}
+
+	// String offsets are relative to the start of the header
+	addString := func(s string) uint32 {
+		offset := uint32(len(data))
+		data = append(data, s+"\x00"...)
+		return offset
+	}
+	for i, entry := range entries {
+		soname := addString(entry.soname)
+		path := addString(entry.path)
+		e := data[ldCacheHeaderNew+i*ldCacheEntryNew:]
+		order.PutUint32(e[0:], entry.flags)
+		order.PutUint32(e[4:], soname)
+		order.PutUint32(e[8:], path)
+		order.PutUint64(e[16:], entry.hwcap)
+	}
+	if len(hwcaps) == 0 {
+		return data
+	}
+
+	addUint32 := func(v uint32) {
+		var buf [4]byte
+		order.PutUint32(buf[:], v)
+		data = append(data, buf[:]...)
+	}
+	var names []uint32
+	for _, name := range hwcaps {
+		names = append(names, addString(name))
+	}
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+	section := uint32(len(data))
+	for _, name := range names {
+		addUint32(name)
+	}
+	extension := uint32(len(data))
+	addUint32(ldCacheExtensionMagic)
+	addUint32(1)
+	addUint32(ldCacheTagHWCaps)
+	addUint32(0)
+	addUint32(section)
+	addUint32(uint32(len(names) * 4))
+	order.PutUint32(data[32:], extension)
+	return data
+}
+
+// buildLdCacheCombined will return an old format cache followed by the new
+// format, as written by ldconfig -c compat. The old entries share the
+// strings of the new format, which their offsets are relative to.
+func buildLdCacheCombined(entries []testCacheEntry) []byte {
+	order := binary.LittleEndian
+	newData := buildLdCacheNew(order, entries, nil)
+	data := make([]byte, ldCacheHeaderOld+len(entries)*ldCacheEntryOld)
+	copy(data, ldCacheMagicOld)
+	order.PutUint32(data[12:], uint32(len(entries)))
+	for i := range entries {
+		copy(data[ldCacheHeaderOld+i*ldCacheEntryOld:], newData[ldCacheHeaderNew+i*ldCacheEntryNew:][:ldCacheEntryOld])
+	}
+	for len(data)%8 != 0 {
+		data = append(data, 0)
+	}
+	return append(data, newData...)
+}
+
+func TestParseLdCache(t *testing.T) {
+	libc := testCacheEntry{flags: 0x303, soname: "libc.so.6", path: "/usr/lib64/libc.so.6"}
+	libz := testCacheEntry{flags: 0x303, soname: "libz.so.1", path: "/usr/lib64/libz.so.1"}
+	hwcapLibz := testCacheEntry{
+		flags:  0x303,
+		soname: "libz.so.1",
+		path:   "/usr/lib64/glibc-hwcaps/x86-64-v3/libz.so.1",
+		hwcap:  ldCacheHWCapExtension,
+	}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		want   []*LdCacheEntry
+	}{
+		{
+			name:   "old",
+			data:   buildLdCacheOld([]testCacheEntry{libc, libz}),
+			format: ldCacheMagicOld,
+			want: []*LdCacheEntry{
+				{Flags: 0x303, Soname: "libc.so.6", Path: "/usr/lib64/libc.so.6"},
+				{Flags: 0x303, Soname: "libz.so.1", Path: "/usr/lib64/libz.so.1"},
+			},
+		},
+		{
+			name:   "new little endian",
+			data:   buildLdCacheNew(binary.LittleEndian, []testCacheEntry{libc, libz}, nil),
+			format: ldCacheMagicNew,
+			want: []*LdCacheEntry{
+				{Flags: 0x303, Soname: "libc.so.6", Path: "/usr/lib64/libc.so.6"},
+				{Flags: 0x303, Soname: "libz.so.1", Path: "/usr/lib64/libz.so.1"},
+			},
+		},
+		{
+			name:   "new big endian",
+			data:   buildLdCacheNew(binary.BigEndian, []testCacheEntry{libc}, nil),
+			format: ldCacheMagicNew,
+			want: []*LdCacheEntry{
+				{Flags: 0x303, Soname: "libc.so.6", Path: "/usr/lib64/libc.so.6"},
+			},
+		},
+		{
+			name:   "new with glibc-hwcaps",
+			data:   buildLdCacheNew(binary.LittleEndian, []testCacheEntry{hwcapLibz, libz}, []string{"x86-64-v3"}),
+			format: ldCacheMagicNew,
+			want: []*LdCacheEntry{
+				{
+					Flags:  0x303,
+					Soname: "libz.so.1",
+					Path:   "/usr/lib64/glibc-hwcaps/x86-64-v3/libz.so.1",
+					HWCap:  ldCacheHWCapExtension,
+					HWCaps: "x86-64-v3",
+				},
+				{Flags: 0x303, Soname: "libz.so.1", Path: "/usr/lib64/libz.so.1"},
+			},
+		},
+		{
+			name:   "combined",
+			data:   buildLdCacheCombined([]testCacheEntry{libz}),
+			format: ldCacheMagicNew,
+			want: []*LdCacheEntry{
+				{Flags: 0x303, Soname: "libz.so.1", Path: "/usr/lib64/libz.so.1"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache, err := ParseLdCache(test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cache.Format != test.format {
+				t.Errorf("format %q, want %q", cache.Format, test.format)
+			}
+			if !reflect.DeepEqual(cache.Entries, test.want) {
+				for _, entry := range cache.Entries {
+					t.Logf("got %+v", *entry)
+				}
+				t.Errorf("entries do not match")
+			}
+		})
+	}
+}
+
+func TestParseLdCacheMalformed(t *testing.T) {
+	order := binary.LittleEndian
+	old := buildLdCacheOld([]testCacheEntry{{soname: "libc.so.6", path: "/usr/lib64/libc.so.6"}})
+	new := buildLdCacheNew(order, []testCacheEntry{{soname: "libc.so.6", path: "/usr/lib64/libc.so.6"}}, nil)
+	hwcaps := buildLdCacheNew(order, []testCacheEntry{{
+		soname: "libc.so.6",
+		path:   "/usr/lib64/glibc-hwcaps/x86-64-v3/libc.so.6",
+		hwcap:  ldCacheHWCapExtension,
+	}}, []string{"x86-64-v3"})
+
+	// modify will return a copy of data altered by fn
+	modify := func(data []byte, fn func([]byte)) []byte {
+		ret := append([]byte{}, data...)
+		fn(ret)
+		return ret
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"unknown magic", []byte("not a cache at all, not at all")},
+		{"old truncated header", []byte(ldCacheMagicOld)},
+		{"old truncated entries", old[:ldCacheHeaderOld+4]},
+		{"old too many entries", modify(old, func(d []byte) { order.PutUint32(d[12:], 0xffffffff) })},
+		{"old string out of range", modify(old, func(d []byte) { order.PutUint32(d[ldCacheHeaderOld+4:], 0xfffffff0) })},
+		{"old unterminated string", old[:len(old)-1]},
+		{"new truncated header", new[:ldCacheHeaderNew-1]},
+		{"new truncated entries", new[:ldCacheHeaderNew+ldCacheEntryNew-1]},
+		{"new too many entries", modify(new, func(d []byte) { order.PutUint32(d[20:], 0xffffffff) })},
+		{"new string out of range", modify(new, func(d []byte) { order.PutUint32(d[ldCacheHeaderNew+8:], 0xfffffff0) })},
+		{"new unterminated string", new[:len(new)-1]},
+		{"hwcaps truncated extension", hwcaps[:len(hwcaps)-4]},
+		{"hwcaps invalid index", modify(hwcaps, func(d []byte) { order.PutUint64(d[ldCacheHeaderNew+16:], ldCacheHWCapExtension|7) })},
+		{"hwcaps section out of range", modify(hwcaps, func(d []byte) { order.PutUint32(d[len(d)-8:], 0xfffffff0) })},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if cache, err := ParseLdCache(test.data); err == nil {
+				t.Errorf("expected an error, got %d entries", len(cache.Entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// ldSoConf is the location of the dynamic loader configuration
+	ldSoConf = "/etc/ld.so.conf"
+
+	// ldSoConfDir is globbed in place of ldSoConf when it is missing, as
+	// some distributions only ship the drop-in files.
+	ldSoConfDir = "/etc/ld.so.conf.d/*.conf"
+)
+
+// ParseLdSoConf will parse /etc/ld.so.conf within the root, including
+// any files pulled in with the "include" directive, and return the library
+// directories it lists in order. The returned paths are relative to the
+// root, i.e. /usr/lib64/mysql. When ld.so.conf is missing, the files in
+// /etc/ld.so.conf.d are parsed in sorted order instead. A missing
+// configuration is not an error.
+func ParseLdSoConf(root string) ([]string, error) {
+	var dirs []string
+	seenDirs := make(map[string]bool)
+	seenFiles := make(map[string]bool)
+
+	var parse func(conf string) error
+
+	// parseGlob will parse every file matching the pattern in sorted order
+	parseGlob := func(pattern string) error {
+		matches, err := filepath.Glob(filepath.Join(root, pattern))
+		if err != nil {
+			return err
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			rel, err := filepath.Rel(root, match)
+			if err != nil {
+				return err
+			}
+			if err := parse(filepath.Join("/", rel)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	parse = func(conf string) error {
+		// Guard against include loops
+		if seenFiles[conf] {
+			return nil
+		}
+		seenFiles[conf] = true
+
+		fi, err := os.Open(filepath.Join(root, conf))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		defer fi.Close()
+
+		sc := bufio.NewScanner(fi)
+		for sc.Scan() {
+			line := sc.Text()
+			if idx := strings.Index(line, "#"); idx >= 0 {
+				line = line[:idx]
+			}
+			fields := strings.FieldsFunc(line, func(r rune) bool {
+				return r == ' ' || r == '\t' || r == ',' || r == ':'
+			})
+			if len(fields) == 0 {
+				continue
+			}
+
+			switch fields[0] {
+			case "include":
+				for _, pattern := range fields[1:] {
+					// Relative includes are relative to the including file
+					if !filepath.IsAbs(pattern) {
+						pattern = filepath.Join(filepath.Dir(conf), pattern)
+					}
+					if err := parseGlob(pattern); err != nil {
+						return err
+					}
+				}
+			case "hwcap":
+				// Obsolete, and not supported by modern glibc
+				continue
+			default:
+				for _, dir := range fields {
+					// Legacy libc4/libc5 type suffix, i.e. /usr/lib=libc5
+					if idx := strings.Index(dir, "="); idx >= 0 {
+						dir = dir[:idx]
+					}
+					dir = filepath.Clean(dir)
+					if !filepath.IsAbs(dir) || seenDirs[dir] {
+						continue
+					}
+					seenDirs[dir] = true
+					dirs = append(dirs, dir)
+				}
+			}
+		}
+		return sc.Err()
+	}
+
+	var err error
+	if _, statErr := os.Stat(filepath.Join(root, ldSoConf)); os.IsNotExist(statErr) {
+		err = parseGlob(ldSoConfDir)
+	} else {
+		err = parse(ldSoConf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
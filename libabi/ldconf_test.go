@@ -0,0 +1,87 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseLdSoConf(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name:  "missing",
+			files: map[string]string{},
+			want:  nil,
+		},
+		{
+			name: "include",
+			files: map[string]string{
+				"etc/ld.so.conf":           "/usr/lib64/first # comment\ninclude ld.so.conf.d/*.conf\n",
+				"etc/ld.so.conf.d/b.conf":  "/usr/lib64/b\n/usr/lib64/first\n",
+				"etc/ld.so.conf.d/a.conf":  "/usr/lib64/a,/usr/lib64/a2\n",
+				"etc/ld.so.conf.d/skip.no": "/usr/lib64/skipped\n",
+			},
+			want: []string{"/usr/lib64/first", "/usr/lib64/a", "/usr/lib64/a2", "/usr/lib64/b"},
+		},
+		{
+			name: "drop-in only",
+			files: map[string]string{
+				"etc/ld.so.conf.d/b.conf":  "/usr/lib64/b\n/usr/lib64/a\n",
+				"etc/ld.so.conf.d/a.conf":  "/usr/lib64/a\n",
+				"etc/ld.so.conf.d/skip.no": "/usr/lib64/skipped\n",
+			},
+			want: []string{"/usr/lib64/a", "/usr/lib64/b"},
+		},
+		{
+			name: "include loop",
+			files: map[string]string{
+				"etc/ld.so.conf":        "include /etc/ld.so.conf\n/usr/lib64/loop=libc6\n",
+				"etc/ld.so.conf.d/conf": "/usr/lib64/unused\n",
+			},
+			want: []string{"/usr/lib64/loop"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range test.files {
+				path := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dirs, err := ParseLdSoConf(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(dirs, test.want) {
+				t.Errorf("got %v, want %v", dirs, test.want)
+			}
+		})
+	}
+}
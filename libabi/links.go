@@ -0,0 +1,237 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/elf"
+	"sort"
+)
+
+// An UnresolvedSymbol is an import of a Record that is not defined by any
+// library within its DT_NEEDED closure.
+type UnresolvedSymbol struct {
+	Record *Record // The binary importing the symbol
+	Symbol *Symbol // The symbol that cannot be resolved
+}
+
+// An UnusedDependency is a DT_NEEDED entry of a Record from which no symbol
+// is imported.
+type UnusedDependency struct {
+	Record *Record // The binary linking the library
+	Soname string  // The library that is not used
+}
+
+// A linkIndex maps sonames to the symbols they define, so that imports can
+// be resolved against the scanned tree and an optional baseline.
+type linkIndex struct {
+	libraries map[string]*Record         // Scanned libraries by name
+	provides  map[string]map[string]bool // Defined names by soname
+	hosts     map[string]bool            // Names defined by the executables
+}
+
+// addDefinition will add the names the symbol may be imported by to names
+func addDefinition(names map[string]bool, symbol *Symbol) {
+	names[symbol.Name] = true
+	if symbol.Version != "" {
+		names[symbol.Name+"@"+symbol.Version] = true
+	}
+}
+
+// newLinkIndex will create a linkIndex for the bucket. The baseline may be
+// nil, otherwise it is used for any soname not found in the bucket. Scanned
+// binaries are indexed by every symbol they define, rather than by those
+// written to the report, which may be filtered with LegacySymbols.
+func newLinkIndex(bucket, baseline *Architecture) *linkIndex {
+	index := &linkIndex{
+		libraries: make(map[string]*Record),
+		provides:  make(map[string]map[string]bool),
+		hosts:     make(map[string]bool),
+	}
+
+	if baseline != nil {
+		for soname, symbols := range baseline.Symbols {
+			index.provides[soname] = make(map[string]bool)
+			for key := range symbols {
+				addDefinition(index.provides[soname], ParseSymbol(key))
+			}
+		}
+	}
+
+	// Scanned libraries always take precedence over the baseline
+	for _, record := range bucket.Records {
+		// Plugins may resolve symbols from the executable loading them,
+		// but not from runnable libraries such as libc
+		if record.PrimaryType() == RecordTypeExecutable {
+			for _, symbol := range record.Definitions {
+				addDefinition(index.hosts, symbol)
+			}
+		}
+		if record.Flags&RecordTypeLibrary != RecordTypeLibrary {
+			continue
+		}
+		// Binaries are linked against the baseline build, not its variants
+		if record.Variant != "" {
+			continue
+		}
+		if _, ok := index.libraries[record.Name]; ok {
+			continue
+		}
+		index.libraries[record.Name] = record
+		index.provides[record.Name] = make(map[string]bool)
+		for _, symbol := range record.Definitions {
+			addDefinition(index.provides[record.Name], symbol)
+		}
+	}
+	return index
+}
+
+// closure will return every soname in the transitive DT_NEEDED closure of
+// the record, as far as it can be followed within the scanned tree.
+func (l *linkIndex) closure(record *Record) []string {
+	var ret []string
+	seen := make(map[string]bool)
+	queue := append([]string{}, record.Dependencies...)
+
+	for len(queue) > 0 {
+		soname := queue[0]
+		queue = queue[1:]
+		if seen[soname] {
+			continue
+		}
+		seen[soname] = true
+		ret = append(ret, soname)
+		if lib, ok := l.libraries[soname]; ok {
+			queue = append(queue, lib.Dependencies...)
+		}
+	}
+	return ret
+}
+
+// defines will determine whether the soname defines a symbol satisfying
+// the import.
+func (l *linkIndex) defines(soname string, symbol *Symbol) bool {
+	return definesName(l.provides[soname], symbol)
+}
+
+// definesName will determine whether names holds a symbol satisfying the
+// import.
+func definesName(names map[string]bool, symbol *Symbol) bool {
+	if symbol.Version != "" {
+		return names[symbol.Name+"@"+symbol.Version]
+	}
+	return names[symbol.Name]
+}
+
+// CheckUnderlinking will find every import within the bucket that is not
+// satisfied by the transitive DT_NEEDED closure of the importing binary.
+// Sonames not found in the bucket are looked up in the baseline, which may
+// be nil.
+//
+// When a soname in the closure is unknown, any unversioned import could be
+// provided by it, so those imports are only reported when every soname in
+// the closure is known. Versioned imports requiring a library that is not
+// part of the closure are always reported. Weak imports are never reported.
+// Imports of plugins are also resolved against the symbols exported by any
+// executable in the bucket, as these are loaded by their host.
+func (a *Architecture) CheckUnderlinking(baseline *Architecture) []*UnresolvedSymbol {
+	var ret []*UnresolvedSymbol
+	index := newLinkIndex(a, baseline)
+
+	for _, record := range a.Records {
+		closure := index.closure(record)
+		inClosure := make(map[string]bool)
+		hasUnknown := false
+		for _, soname := range closure {
+			inClosure[soname] = true
+			if _, ok := index.provides[soname]; !ok {
+				hasUnknown = true
+			}
+		}
+
+		for _, symbol := range record.Imports {
+			if symbol.Binding == elf.STB_WEAK {
+				continue
+			}
+			resolved := false
+			for _, soname := range closure {
+				if index.defines(soname, symbol) {
+					resolved = true
+					break
+				}
+			}
+			if !resolved && record.Flags&RecordTypePlugin == RecordTypePlugin {
+				resolved = definesName(index.hosts, symbol)
+			}
+			if resolved {
+				continue
+			}
+			if hasUnknown && (symbol.Library == "" || inClosure[symbol.Library]) {
+				continue
+			}
+			ret = append(ret, &UnresolvedSymbol{Record: record, Symbol: symbol})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Record.Path != ret[j].Record.Path {
+			return ret[i].Record.Path < ret[j].Record.Path
+		}
+		return ret[i].Symbol.String() < ret[j].Symbol.String()
+	})
+	return ret
+}
+
+// CheckOverlinking will find every DT_NEEDED entry within the bucket that
+// does not define any of the symbols imported by the binary, which is the
+// equivalent of "ldd -u". Sonames not found in the bucket are looked up in
+// the baseline, which may be nil, and are skipped when unknown. Libraries
+// are matched against every symbol they define, so that a dependency used
+// only for its weak or data symbols is not reported with LegacySymbols.
+//
+// Note that a library may still be needed for its side effects, such as
+// running constructors, which cannot be determined here.
+func (a *Architecture) CheckOverlinking(baseline *Architecture) []*UnusedDependency {
+	var ret []*UnusedDependency
+	index := newLinkIndex(a, baseline)
+
+	for _, record := range a.Records {
+		for _, soname := range record.Dependencies {
+			if _, ok := index.provides[soname]; !ok {
+				continue
+			}
+			used := false
+			for _, symbol := range record.Imports {
+				// Versioned imports are bound to their library
+				if symbol.Library != "" && symbol.Library != soname {
+					continue
+				}
+				if index.defines(soname, symbol) {
+					used = true
+					break
+				}
+			}
+			if !used {
+				ret = append(ret, &UnusedDependency{Record: record, Soname: soname})
+			}
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Record.Path < ret[j].Record.Path
+	})
+	return ret
+}
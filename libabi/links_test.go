@@ -0,0 +1,163 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/elf"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// compileFixture will compile the C source with gcc using the given
+// arguments, skipping the test when no compiler is available.
+func compileFixture(t *testing.T, source string, args ...string) {
+	t.Helper()
+	compileWith(t, "gcc", "fixture.c", source, args...)
+}
+
+// compileWith will compile the source, written to a file of the given name,
+// with the compiler and arguments, skipping the test when the compiler is
+// not available.
+func compileWith(t *testing.T, compiler, name, source string, args ...string) {
+	t.Helper()
+	path, err := exec.LookPath(compiler)
+	if err != nil {
+		t.Skipf("%s is required to build the fixtures", compiler)
+	}
+	src := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(src, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(path, append([]string{src}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s %v: %v\n%s", compiler, args, err, out)
+	}
+}
+
+func TestLinksPluginResolvesFromHost(t *testing.T) {
+	bucket := NewArchitecture(elf.EM_X86_64)
+	bucket.Records = []*Record{
+		{
+			Path:        "/usr/bin/host",
+			Name:        "host",
+			Flags:       RecordTypeExecutable,
+			Definitions: []*Symbol{{Name: "host_register"}},
+		},
+		{
+			Path:        "/usr/lib64/libc.so.6",
+			Name:        "libc.so.6",
+			Flags:       RecordTypeLibrary | RecordTypeExecutable | RecordTypeExport,
+			Definitions: []*Symbol{{Name: "printf"}},
+		},
+		{
+			Path:    "/usr/lib64/host/plugin.so",
+			Name:    "plugin.so",
+			Flags:   RecordTypeLibrary | RecordTypePlugin,
+			Imports: []*Symbol{{Name: "host_register", Undefined: true, Binding: elf.STB_GLOBAL}},
+		},
+		{
+			Path:    "/usr/lib64/host/unlinked.so",
+			Name:    "unlinked.so",
+			Flags:   RecordTypeLibrary | RecordTypePlugin,
+			Imports: []*Symbol{{Name: "printf", Undefined: true, Binding: elf.STB_GLOBAL}},
+		},
+		{
+			Path:    "/usr/lib64/libother.so.1",
+			Name:    "libother.so.1",
+			Flags:   RecordTypeLibrary | RecordTypeExport,
+			Imports: []*Symbol{{Name: "host_register", Undefined: true, Binding: elf.STB_GLOBAL}},
+		},
+	}
+
+	unresolved := bucket.CheckUnderlinking(nil)
+	var names []string
+	for _, entry := range unresolved {
+		names = append(names, entry.Record.Name)
+	}
+	want := []string{"unlinked.so", "libother.so.1"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("unresolved records %v, want %v", names, want)
+	}
+}
+
+// scanLegacyFixture will build and scan a library exporting only symbols
+// filtered out by LegacySymbols, an executable linked against it, and a
+// plugin resolving a symbol from the executable.
+func scanLegacyFixture(t *testing.T) *Report {
+	t.Helper()
+	root := t.TempDir()
+	libDir := filepath.Join(root, "usr", "lib64")
+	binDir := filepath.Join(root, "usr", "bin")
+	pluginDir := filepath.Join(libDir, "host")
+	for _, dir := range []string{libDir, binDir, pluginDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only weak and data exports, all of which LegacySymbols filters out
+	lib := filepath.Join(libDir, "libdep.so.1")
+	compileFixture(t, `
+int dep_data = 1;
+__attribute__((weak)) int dep_weak(void) { return dep_data; }
+`, "-shared", "-fPIC", "-Wl,-soname,libdep.so.1", "-o", lib)
+
+	compileFixture(t, `
+extern int dep_data;
+int dep_weak(void);
+int host_register(int x) { return x; }
+int main(void) { return dep_weak() + dep_data; }
+`, "-rdynamic", "-o", filepath.Join(binDir, "host"), lib)
+
+	compileFixture(t, `
+int host_register(int x);
+int plugin_init(void) { return host_register(1); }
+`, "-shared", "-fPIC", "-o", filepath.Join(pluginDir, "plugin.so"))
+
+	LegacySymbols = true
+	defer func() { LegacySymbols = false }()
+
+	report, err := NewReport(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Walk(); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestUnderlinkingLegacySymbols(t *testing.T) {
+	report := scanLegacyFixture(t)
+	for _, arch := range report.Arches {
+		for _, unresolved := range arch.CheckUnderlinking(nil) {
+			t.Errorf("%s: undefined symbol %s", unresolved.Record.Path, unresolved.Symbol)
+		}
+	}
+}
+
+func TestOverlinkingLegacySymbols(t *testing.T) {
+	report := scanLegacyFixture(t)
+	for _, arch := range report.Arches {
+		for _, unused := range arch.CheckOverlinking(nil) {
+			t.Errorf("%s: unused %s", unused.Record.Path, unused.Soname)
+		}
+	}
+}
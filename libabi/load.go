@@ -0,0 +1,198 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// reportSuffixes will return the suffix of every report file in dir that
+// starts with prefix+name, mapped to the architecture it was generated for.
+// Files with an unknown suffix are ignored.
+func reportSuffixes(dir, prefix, name string) (map[string]*Architecture, error) {
+	base := prefix + name
+	matches, err := filepath.Glob(filepath.Join(dir, base+"*"))
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]*Architecture)
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(filepath.Base(match), base)
+		if arch, ok := ArchitectureForSuffix(suffix); ok {
+			ret[suffix] = arch
+		}
+	}
+	return ret, nil
+}
+
+// IsReportDir will determine whether dir contains any report files using
+// the given prefix.
+func IsReportDir(dir, prefix string) bool {
+	for _, name := range ReportFiles {
+		if found, err := reportSuffixes(dir, prefix, name); err == nil && len(found) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// readReportLines will return all non-empty lines from the given report
+// file. A missing file is treated as being empty.
+func readReportLines(path string) ([]string, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fi.Close()
+
+	var lines []string
+	sc := bufio.NewScanner(fi)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, sc.Err()
+}
+
+// loadSonameMap will populate the mapping from a $soname:$value file
+func loadSonameMap(path string, mapping map[string]map[string]bool) error {
+	lines, err := readReportLines(path)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		idx := strings.Index(line, ":")
+		if idx < 1 || idx == len(line)-1 {
+			return fmt.Errorf("%s: malformed line: %s", path, line)
+		}
+		soname := line[:idx]
+		values, ok := mapping[soname]
+		if !ok {
+			values = make(map[string]bool)
+			mapping[soname] = values
+		}
+		// Drop the demangled column of the symbols, if any
+		value := line[idx+1:]
+		if tab := strings.Index(value, "\t"); tab > 0 {
+			value = value[:tab]
+		}
+		values[value] = true
+	}
+	return nil
+}
+
+// loadDeps will populate the bucket from a used_libs file
+func loadDeps(path string, bucket *Architecture) error {
+	lines, err := readReportLines(path)
+	if err != nil {
+		return err
+	}
+	for _, dep := range lines {
+		bucket.Dependencies[dep] = true
+	}
+	return nil
+}
+
+// LoadReport will reconstruct a Report from the report files
+// previously written into dir with the given prefix. Each file suffix is
+// mapped back to its architecture, so that the resulting Arches match those of
+// a freshly scanned tree.
+//
+// Only the exported symbols and dependencies are stored in report files, so
+// the returned Report has no hidden symbols and cannot be walked.
+func LoadReport(dir, prefix string) (*Report, error) {
+	symbolFiles, err := reportSuffixes(dir, prefix, "symbols")
+	if err != nil {
+		return nil, err
+	}
+	depFiles, err := reportSuffixes(dir, prefix, "used_libs")
+	if err != nil {
+		return nil, err
+	}
+	versionFiles, err := reportSuffixes(dir, prefix, "versions")
+	if err != nil {
+		return nil, err
+	}
+	signatureFiles, err := reportSuffixes(dir, prefix, "signatures")
+	if err != nil {
+		return nil, err
+	}
+	typeFiles, err := reportSuffixes(dir, prefix, "types")
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Root:   dir,
+		Arches: make(map[ArchitectureKey]*Architecture),
+	}
+	getBucket := func(arch *Architecture) *Architecture {
+		if bucket, ok := report.Arches[arch.Key()]; ok {
+			return bucket
+		}
+		report.Arches[arch.Key()] = arch
+		return arch
+	}
+
+	for suffix, arch := range symbolFiles {
+		path := filepath.Join(dir, fmt.Sprintf("%ssymbols%s", prefix, suffix))
+		if err := loadSonameMap(path, getBucket(arch).Symbols); err != nil {
+			return nil, err
+		}
+	}
+	for suffix, arch := range versionFiles {
+		path := filepath.Join(dir, fmt.Sprintf("%sversions%s", prefix, suffix))
+		if err := loadSonameMap(path, getBucket(arch).Versions); err != nil {
+			return nil, err
+		}
+	}
+	for suffix, arch := range signatureFiles {
+		path := filepath.Join(dir, fmt.Sprintf("%ssignatures%s", prefix, suffix))
+		if err := loadSonameMap(path, getBucket(arch).Signatures); err != nil {
+			return nil, err
+		}
+	}
+	for suffix, arch := range typeFiles {
+		path := filepath.Join(dir, fmt.Sprintf("%stypes%s", prefix, suffix))
+		if err := loadSonameMap(path, getBucket(arch).Types); err != nil {
+			return nil, err
+		}
+	}
+	for suffix, arch := range depFiles {
+		path := filepath.Join(dir, fmt.Sprintf("%sused_libs%s", prefix, suffix))
+		if err := loadDeps(path, getBucket(arch)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Truncated reports leave empty files behind, don't treat them as
+	// an architecture being present.
+	for key, bucket := range report.Arches {
+		if len(bucket.Symbols) == 0 && len(bucket.Versions) == 0 && len(bucket.Dependencies) == 0 {
+			delete(report.Arches, key)
+		}
+	}
+	return report, nil
+}
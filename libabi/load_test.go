@@ -0,0 +1,161 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// withOutputDir will point ReportOutputDir at dir for the rest of the test
+func withOutputDir(t *testing.T, dir string) {
+	t.Helper()
+	oldDir := ReportOutputDir
+	ReportOutputDir = dir
+	t.Cleanup(func() { ReportOutputDir = oldDir })
+}
+
+func TestLoadReportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	withOutputDir(t, dir)
+	Demangle = true
+	defer func() { Demangle = false }()
+
+	tests := []struct {
+		suffix  string
+		machine elf.Machine
+		class   elf.Class
+	}{
+		{"", elf.EM_X86_64, elf.ELFCLASS64},
+		{"32", elf.EM_386, elf.ELFCLASS32},
+		{"x32", elf.EM_X86_64, elf.ELFCLASS32},
+		{"aarch64", elf.EM_AARCH64, elf.ELFCLASS64},
+		{"ppc64", elf.EM_PPC64, elf.ELFCLASS64},
+	}
+
+	report := newTestReport()
+	for _, test := range tests {
+		bucket := mustArchitecture(t, test.suffix)
+		addSymbols(bucket, "libfoo.so.1",
+			"foo@@FOO_1",
+			"foo@FOO_0",
+			"_ZN3Foo3barEi@@FOO_1",
+			"table@@FOO_1 [OBJECT size=16]",
+		)
+		bucket.Versions["libfoo.so.1"] = map[string]bool{"FOO_0": true, "FOO_1 FOO_0": true}
+		bucket.Signatures["libfoo.so.1"] = map[string]bool{"foo@@FOO_1:int foo(int)": true}
+		bucket.Types["libfoo.so.1"] = map[string]bool{"struct point = struct {size=8; int x@0; int y@4}": true}
+		bucket.Dependencies["libc.so.6"] = true
+		report.Arches[bucket.Key()] = bucket
+		if err := report.Report("pkg_", bucket); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The demangled column is written, but must not be read back
+	data, err := os.ReadFile(filepath.Join(dir, "pkg_symbols32"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "libfoo.so.1:_ZN3Foo3barEi@@FOO_1\tFoo::bar(int)\n") {
+		t.Fatalf("missing demangled column in:\n%s", data)
+	}
+
+	loaded, err := LoadReport(dir, "pkg_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Arches) != len(tests) {
+		t.Fatalf("loaded %d architectures, want %d", len(loaded.Arches), len(tests))
+	}
+	for _, test := range tests {
+		want := mustArchitecture(t, test.suffix)
+		got, ok := loaded.Arches[want.Key()]
+		if !ok {
+			t.Errorf("suffix %q: architecture not loaded", test.suffix)
+			continue
+		}
+		if got.Machine != test.machine || got.Class != test.class || got.GetPathSuffix() != test.suffix {
+			t.Errorf("suffix %q: loaded %s %s with suffix %q", test.suffix, got.Machine, got.Class, got.GetPathSuffix())
+		}
+		orig := report.Arches[want.Key()]
+		for name, pair := range map[string][2]interface{}{
+			"symbols":    {got.Symbols, orig.Symbols},
+			"versions":   {got.Versions, orig.Versions},
+			"signatures": {got.Signatures, orig.Signatures},
+			"types":      {got.Types, orig.Types},
+			"used_libs":  {got.Dependencies, orig.Dependencies},
+		} {
+			if !reflect.DeepEqual(pair[0], pair[1]) {
+				t.Errorf("suffix %q: %s %v, want %v", test.suffix, name, pair[0], pair[1])
+			}
+		}
+	}
+
+	// Another prefix finds nothing
+	other, err := LoadReport(dir, "other_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.Arches) != 0 {
+		t.Errorf("loaded %d architectures for an unknown prefix", len(other.Arches))
+	}
+}
+
+func TestLoadReportFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		arches int
+		fail   bool
+	}{
+		{"missing directory", nil, 0, false},
+		{"empty files", map[string]string{"symbols": "", "used_libs32": "", "versions": ""}, 0, false},
+		{"blank lines", map[string]string{"symbols": "\n\nlibfoo.so.1:foo\n\n"}, 1, false},
+		{"only used_libs", map[string]string{"used_libs32": "libc.so.6\n"}, 1, false},
+		{"unknown suffix", map[string]string{"symbolsnotanarch": "libfoo.so.1:foo\n"}, 0, false},
+		{"machine name suffix", map[string]string{"symbolsEM_SPARCV9": "libfoo.so.1:foo\n"}, 1, false},
+		{"missing soname", map[string]string{"symbols": ":foo\n"}, 0, true},
+		{"missing value", map[string]string{"symbols": "libfoo.so.1:\n"}, 0, true},
+		{"no separator", map[string]string{"symbols": "libfoo.so.1\n"}, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "reports")
+			for name, content := range test.files {
+				writeTestFile(t, dir, name, content)
+			}
+			report, err := LoadReport(dir, "")
+			if test.fail {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Arches) != test.arches {
+				t.Errorf("loaded %d architectures, want %d", len(report.Arches), test.arches)
+			}
+		})
+	}
+}
@@ -18,9 +18,12 @@ package libabi
 
 import (
 	"debug/elf"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
-// An Architecture is created for each ELF Machine type, and is used to group
+// An Architecture is created for each ELF ABI, and is used to group
 // similar libraries and binaries in one place. This enables accounting for
 // multilib/multiarch builds, to enable separate reports per architecture.
 //
@@ -29,9 +32,16 @@ import (
 // cases, i.e. ld-linux*
 type Architecture struct {
 	Machine       elf.Machine                // Corresponding machine for this configuration
+	Class         elf.Class                  // ELF class for this configuration
+	Data          elf.Data                   // Data encoding for this configuration
+	ABIFlags      uint32                     // Processor specific flags (e_flags)
 	Symbols       map[string]map[string]bool // Symbols exported for this architecture
 	HiddenSymbols map[string]map[string]bool // Symbols found but not exported
+	Versions      map[string]map[string]bool // Version nodes of exported sonames
+	Signatures    map[string]map[string]bool // Function prototypes of exported sonames
+	Types         map[string]map[string]bool // Type layouts of exported sonames
 	Dependencies  map[string]bool            // Dependencies for this architecture
+	Records       []*Record                  // Every record stored in this bucket
 }
 
 // NewArchitecture will create a new Architecture and initialise the fields
@@ -40,10 +50,22 @@ func NewArchitecture(m elf.Machine) *Architecture {
 		Machine:       m,
 		Symbols:       make(map[string]map[string]bool),
 		HiddenSymbols: make(map[string]map[string]bool),
+		Versions:      make(map[string]map[string]bool),
+		Signatures:    make(map[string]map[string]bool),
+		Types:         make(map[string]map[string]bool),
 		Dependencies:  make(map[string]bool),
 	}
 }
 
+// empty will return a new, empty Architecture for the same ABI
+func (a *Architecture) empty() *Architecture {
+	arch := NewArchitecture(a.Machine)
+	arch.Class = a.Class
+	arch.Data = a.Data
+	arch.ABIFlags = a.ABIFlags
+	return arch
+}
+
 // GetSymbolsTarget will return the appropriate symbol store for the
 // given record, based on it's symbol visibility (soname presence)
 func (a *Architecture) GetSymbolsTarget(r *Record) map[string]map[string]bool {
@@ -53,28 +75,403 @@ func (a *Architecture) GetSymbolsTarget(r *Record) map[string]map[string]bool {
 	return a.HiddenSymbols
 }
 
+// exportedRecord will return the scanned record of an exported soname,
+// which is nil for a loaded report.
+func (a *Architecture) exportedRecord(soname string) *Record {
+	for _, record := range a.Records {
+		if record.Name == soname && record.Flags&RecordTypeExport == RecordTypeExport {
+			return record
+		}
+	}
+	return nil
+}
+
+// exportedSymbols will return the symbols exported by the soname, sorted as
+// in the symbols file. Scanned records hold the complete symbols, while a
+// loaded report only has what was written to the symbols file.
+func (a *Architecture) exportedSymbols(soname string) []*Symbol {
+	var ret []*Symbol
+	if record := a.exportedRecord(soname); record != nil {
+		ret = append(ret, record.Symbols...)
+	} else {
+		for key := range a.Symbols[soname] {
+			ret = append(ret, ParseSymbol(key))
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].String() < ret[j].String() })
+	return ret
+}
+
+// UsedLibs will return a sorted list of the sonames that this bucket
+// depends on, filtering out any names that are provided within the bucket
+// itself to generate a true report based on DT_NEEDED requirements.
+func (a *Architecture) UsedLibs() []string {
+	var depNames []string
+	for nom := range a.Dependencies {
+		// Skip provided
+		if a.isProvided(nom) {
+			continue
+		}
+		depNames = append(depNames, nom)
+	}
+	sort.Strings(depNames)
+	return depNames
+}
+
+// CountRecords will return the number of records in this bucket that have
+// all of the given flags set, i.e. RecordTypeLibrary|RecordTypeExecutable
+// for shared libraries that can also be run.
+func (a *Architecture) CountRecords(flags RecordType) int {
+	count := 0
+	for _, record := range a.Records {
+		if record.Flags&flags == flags {
+			count++
+		}
+	}
+	return count
+}
+
+// CountPrimary will return the number of records in this bucket with the
+// given primary type, so that every record is counted exactly once.
+func (a *Architecture) CountPrimary(t RecordType) int {
+	count := 0
+	for _, record := range a.Records {
+		if record.PrimaryType() == t {
+			count++
+		}
+	}
+	return count
+}
+
+// RecordCounts holds the number of records of each kind within a bucket.
+// Executables and SharedObjects count every record once, by its primary
+// type, while the others are subsets of them.
+type RecordCounts struct {
+	Executables   int // Executables, including PIE
+	PIE           int // Position independent executables
+	SharedObjects int // Shared libraries, including plugins
+	Runnable      int // Shared libraries that can also be run, i.e. libc.so.6
+	Plugins       int // Shared libraries without a soname
+}
+
+// Counts will return the number of records of each kind in this bucket
+func (a *Architecture) Counts() RecordCounts {
+	return RecordCounts{
+		Executables:   a.CountPrimary(RecordTypeExecutable),
+		PIE:           a.CountRecords(RecordTypeExecutable | RecordTypePIE),
+		SharedObjects: a.CountPrimary(RecordTypeLibrary),
+		Runnable:      a.CountRecords(RecordTypeLibrary | RecordTypeExecutable),
+		Plugins:       a.CountRecords(RecordTypeLibrary | RecordTypePlugin),
+	}
+}
+
+// isProvided will determine if the soname is provided within this bucket
+func (a *Architecture) isProvided(soname string) bool {
+	if _, ok := a.Symbols[soname]; ok {
+		return true
+	}
+	_, ok := a.HiddenSymbols[soname]
+	return ok
+}
+
+// UsedSymbols will return the symbols imported by the records in this
+// bucket that are not defined by any library within it, mapped by the
+// soname expected to provide them.
+//
+// Versioned symbols are attributed to the library named in .gnu.version_r.
+// Unversioned symbols are attributed to the only external DT_NEEDED entry of
+// the importing binary, and to "*" when there is more than one candidate.
+func (a *Architecture) UsedSymbols() map[string]map[string]bool {
+	defined := make(map[string]bool)
+	for _, record := range a.Records {
+		if record.Flags&RecordTypeLibrary != RecordTypeLibrary {
+			continue
+		}
+		for _, symbol := range record.Symbols {
+			defined[symbol.Name] = true
+			if symbol.Version != "" {
+				defined[symbol.Name+"@"+symbol.Version] = true
+			}
+		}
+	}
+
+	ret := make(map[string]map[string]bool)
+	for _, record := range a.Records {
+		var external []string
+		for _, dep := range record.Dependencies {
+			if !a.isProvided(dep) {
+				external = append(external, dep)
+			}
+		}
+
+		for _, symbol := range record.Imports {
+			// Unversioned weak references are optional hooks, such as
+			// __gmon_start__, and are not expected to be provided.
+			if symbol.Version == "" && symbol.Binding == elf.STB_WEAK {
+				continue
+			}
+			if symbol.Version == "" && defined[symbol.Name] {
+				continue
+			}
+			if symbol.Version != "" && defined[symbol.Name+"@"+symbol.Version] {
+				continue
+			}
+
+			soname := symbol.Library
+			if soname == "" {
+				if len(external) == 1 {
+					soname = external[0]
+				} else {
+					soname = "*"
+				}
+			}
+
+			symbolsMap, ok := ret[soname]
+			if !ok {
+				symbolsMap = make(map[string]bool)
+				ret[soname] = symbolsMap
+			}
+			symbolsMap[symbol.String()] = true
+		}
+	}
+	return ret
+}
+
 // GetBucket will return an appropriate storage slot for the given
 // record. If a bucket does not exist it will be created.
 func (a *Report) GetBucket(record *Record) *Architecture {
-	if arch, ok := a.Arches[record.Machine]; ok {
+	bucket := NewArchitecture(record.Machine)
+	bucket.Class = record.Class()
+	bucket.Data = record.Data
+	bucket.ABIFlags = record.ABIFlags
+
+	key := bucket.Key()
+	if arch, ok := a.Arches[key]; ok {
 		return arch
 	}
-
-	bucket := NewArchitecture(record.Machine)
-	a.Arches[record.Machine] = bucket
+	a.Arches[key] = bucket
 	return bucket
 }
 
+// An ArchitectureKey identifies a single ABI. Several ABIs may share the same
+// ELF machine, such as x86_64 and x32, or ARM hard-float and soft-float, so
+// the machine alone is not enough to tell them apart.
+type ArchitectureKey struct {
+	Machine  elf.Machine
+	Class    elf.Class
+	Data     elf.Data
+	ABIFlags uint32 // Only the e_flags that select the ABI
+}
+
+// Less will determine if the key sorts before the other key
+func (k ArchitectureKey) Less(other ArchitectureKey) bool {
+	if k.Machine != other.Machine {
+		return k.Machine < other.Machine
+	}
+	if k.Class != other.Class {
+		return k.Class > other.Class
+	}
+	if k.Data != other.Data {
+		return k.Data < other.Data
+	}
+	return k.ABIFlags > other.ABIFlags
+}
+
+// Key will return the ArchitectureKey for this architecture. Known
+// architectures always map to the same key, regardless of any differences
+// in the flags that don't affect the ABI.
+func (a *Architecture) Key() ArchitectureKey {
+	if m := a.info(); m != nil {
+		return ArchitectureKey{
+			Machine:  m.machine,
+			Class:    m.class,
+			Data:     m.data,
+			ABIFlags: m.abiFlags,
+		}
+	}
+	// Unknown architectures share the report files named after the
+	// machine, so they can only be told apart by the machine.
+	return ArchitectureKey{Machine: a.Machine}
+}
+
+// A machineInfo describes a known architecture, which is identified by the
+// ELF machine, class, data encoding and ABI flags (e_flags) of a file.
+type machineInfo struct {
+	suffix   string      // Report file suffix
+	machine  elf.Machine // ELF machine
+	class    elf.Class   // ELF class, ELFCLASSNONE matches any
+	data     elf.Data    // Data encoding, ELFDATANONE matches any
+	abiFlags uint32      // Required value of e_flags within abiMask
+	abiMask  uint32      // Relevant bits of e_flags
+	triplet  string      // Debian multiarch tuple
+	lib      string      // Library directory name, as used by $LIB
+	platform string      // Baseline value of $PLATFORM (AT_PLATFORM)
+	multilib string      // Multiarch tuple of the 64-bit architecture, for a multilib
+}
+
+const (
+	// efARMABIFloatHard is set in e_flags of ARM hard-float binaries
+	efARMABIFloatHard = 0x400
+
+	// efMIPSABI2 is set in e_flags of MIPS n32 binaries
+	efMIPSABI2 = 0x20
+)
+
+// machineTable is the set of known architectures, the first match wins.
+// The x86_64 and i386 suffixes are kept empty and "32" for compatibility
+// with existing reports.
+var machineTable = []*machineInfo{
+	{suffix: "", machine: elf.EM_X86_64, class: elf.ELFCLASS64, data: elf.ELFDATA2LSB, triplet: "x86_64-linux-gnu", lib: "lib64", platform: "x86_64"},
+	{suffix: "x32", machine: elf.EM_X86_64, class: elf.ELFCLASS32, data: elf.ELFDATA2LSB, triplet: "x86_64-linux-gnux32", lib: "libx32", platform: "x86_64", multilib: "x86_64-linux-gnu"},
+	{suffix: "32", machine: elf.EM_386, class: elf.ELFCLASS32, data: elf.ELFDATA2LSB, triplet: "i386-linux-gnu", lib: "lib", platform: "i686", multilib: "x86_64-linux-gnu"},
+	{suffix: "aarch64", machine: elf.EM_AARCH64, class: elf.ELFCLASS64, data: elf.ELFDATA2LSB, triplet: "aarch64-linux-gnu", lib: "lib64", platform: "aarch64"},
+	{suffix: "armhf", machine: elf.EM_ARM, class: elf.ELFCLASS32, data: elf.ELFDATA2LSB, abiFlags: efARMABIFloatHard, abiMask: efARMABIFloatHard, triplet: "arm-linux-gnueabihf", lib: "lib", platform: "v7l"},
+	{suffix: "armel", machine: elf.EM_ARM, class: elf.ELFCLASS32, data: elf.ELFDATA2LSB, abiMask: efARMABIFloatHard, triplet: "arm-linux-gnueabi", lib: "lib", platform: "v5l"},
+	{suffix: "ppc64le", machine: elf.EM_PPC64, class: elf.ELFCLASS64, data: elf.ELFDATA2LSB, triplet: "powerpc64le-linux-gnu", lib: "lib64", platform: "power8"},
+	{suffix: "ppc64", machine: elf.EM_PPC64, class: elf.ELFCLASS64, data: elf.ELFDATA2MSB, triplet: "powerpc64-linux-gnu", lib: "lib64", platform: "power4"},
+	{suffix: "ppc", machine: elf.EM_PPC, class: elf.ELFCLASS32, data: elf.ELFDATA2MSB, triplet: "powerpc-linux-gnu", lib: "lib", platform: "ppc", multilib: "powerpc64-linux-gnu"},
+	{suffix: "s390x", machine: elf.EM_S390, class: elf.ELFCLASS64, data: elf.ELFDATA2MSB, triplet: "s390x-linux-gnu", lib: "lib64", platform: "z900"},
+	{suffix: "s390", machine: elf.EM_S390, class: elf.ELFCLASS32, data: elf.ELFDATA2MSB, triplet: "s390-linux-gnu", lib: "lib", platform: "z900", multilib: "s390x-linux-gnu"},
+	{suffix: "riscv64", machine: elf.EM_RISCV, class: elf.ELFCLASS64, data: elf.ELFDATA2LSB, triplet: "riscv64-linux-gnu", lib: "lib64", platform: "riscv64"},
+	{suffix: "loongarch64", machine: elf.EM_LOONGARCH, class: elf.ELFCLASS64, data: elf.ELFDATA2LSB, triplet: "loongarch64-linux-gnu", lib: "lib64", platform: "loongarch64"},
+	{suffix: "mips64el", machine: elf.EM_MIPS, class: elf.ELFCLASS64, data: elf.ELFDATA2LSB, triplet: "mips64el-linux-gnuabi64", lib: "lib64", platform: "mips64"},
+	{suffix: "mips64", machine: elf.EM_MIPS, class: elf.ELFCLASS64, data: elf.ELFDATA2MSB, triplet: "mips64-linux-gnuabi64", lib: "lib64", platform: "mips64"},
+	{suffix: "mipsn32el", machine: elf.EM_MIPS, class: elf.ELFCLASS32, data: elf.ELFDATA2LSB, abiFlags: efMIPSABI2, abiMask: efMIPSABI2, triplet: "mips64el-linux-gnuabin32", lib: "lib32", platform: "mips64", multilib: "mips64el-linux-gnuabi64"},
+	{suffix: "mipsn32", machine: elf.EM_MIPS, class: elf.ELFCLASS32, data: elf.ELFDATA2MSB, abiFlags: efMIPSABI2, abiMask: efMIPSABI2, triplet: "mips64-linux-gnuabin32", lib: "lib32", platform: "mips64", multilib: "mips64-linux-gnuabi64"},
+	{suffix: "mipsel", machine: elf.EM_MIPS, class: elf.ELFCLASS32, data: elf.ELFDATA2LSB, abiMask: efMIPSABI2, triplet: "mipsel-linux-gnu", lib: "lib", platform: "mips", multilib: "mips64el-linux-gnuabi64"},
+	{suffix: "mips", machine: elf.EM_MIPS, class: elf.ELFCLASS32, data: elf.ELFDATA2MSB, abiMask: efMIPSABI2, triplet: "mips-linux-gnu", lib: "lib", platform: "mips", multilib: "mips64-linux-gnuabi64"},
+}
+
+// matches will determine if the machine description applies to a file
+func (m *machineInfo) matches(machine elf.Machine, class elf.Class, data elf.Data, abiFlags uint32) bool {
+	if m.machine != machine {
+		return false
+	}
+	if m.class != elf.ELFCLASSNONE && m.class != class {
+		return false
+	}
+	if m.data != elf.ELFDATANONE && m.data != data {
+		return false
+	}
+	return abiFlags&m.abiMask == m.abiFlags
+}
+
+// info will return the known description of this architecture, if any
+func (a *Architecture) info() *machineInfo {
+	for _, m := range machineTable {
+		if m.matches(a.Machine, a.Class, a.Data, a.ABIFlags) {
+			return m
+		}
+	}
+	return nil
+}
+
 // GetPathSuffix will return an appropriate descriptor to use for the
 // bucket configuration. This is used in the generated filenames
 func (a *Architecture) GetPathSuffix() string {
-	// TODO: Flesh out with other types.
-	switch a.Machine {
-	case elf.EM_X86_64:
-		return ""
-	case elf.EM_386:
-		return "32"
-	default:
-		return a.Machine.String()
+	if m := a.info(); m != nil {
+		return m.suffix
+	}
+	return a.Machine.String()
+}
+
+// LibName will return the name of the library directory used for this
+// architecture, which is also the value of $LIB for the dynamic loader.
+func (a *Architecture) LibName() string {
+	if m := a.info(); m != nil {
+		return m.lib
+	}
+	if a.Class == elf.ELFCLASS64 {
+		return "lib64"
+	}
+	return "lib"
+}
+
+// Platform will return the baseline value of $PLATFORM for the dynamic
+// loader on this architecture.
+func (a *Architecture) Platform() string {
+	if m := a.info(); m != nil {
+		return m.platform
+	}
+	return strings.ToLower(strings.TrimPrefix(a.Machine.String(), "EM_"))
+}
+
+// DefaultLibDirs will return the trusted directories that the dynamic loader
+// always searches last for this architecture.
+func (a *Architecture) DefaultLibDirs() []string {
+	lib := a.LibName()
+	return []string{"/" + lib, filepath.Join("/usr", lib)}
+}
+
+// trustedLibDirs will return the default library directories of every known
+// architecture, which are always scanned by ldconfig.
+func trustedLibDirs() []string {
+	var ret []string
+	seen := make(map[string]bool)
+	for _, m := range machineTable {
+		for _, dir := range []string{"/" + m.lib, filepath.Join("/usr", m.lib)} {
+			if !seen[dir] {
+				seen[dir] = true
+				ret = append(ret, dir)
+			}
+		}
+	}
+	return ret
+}
+
+// multiarchLibDirs will return the Debian style multiarch library directories
+// of every known architecture, i.e. /usr/lib/aarch64-linux-gnu
+func multiarchLibDirs() []string {
+	var ret []string
+	for _, m := range machineTable {
+		ret = append(ret, filepath.Join("/usr/lib", m.triplet), filepath.Join("/lib", m.triplet))
+	}
+	return ret
+}
+
+// MultilibOf will return the 64-bit architecture within the report for
+// which this architecture is the 32-bit multilib, i.e. x86_64 for i386.
+func (a *Architecture) MultilibOf(report *Report) (*Architecture, bool) {
+	m := a.info()
+	if m == nil || m.multilib == "" {
+		return nil, false
+	}
+	for _, arch := range report.Arches {
+		if primary := arch.info(); primary != nil && primary.triplet == m.multilib {
+			return arch, true
+		}
+	}
+	return nil, false
+}
+
+// knownSuffixes will return the report suffix of every known architecture
+func knownSuffixes() []string {
+	var ret []string
+	for _, m := range machineTable {
+		ret = append(ret, m.suffix)
+	}
+	return ret
+}
+
+// ArchitectureForSuffix is the inverse of GetPathSuffix, and will return
+// a new, empty Architecture for the machine that a report file with the
+// given suffix was generated for.
+func ArchitectureForSuffix(suffix string) (*Architecture, bool) {
+	for _, m := range machineTable {
+		if m.suffix == suffix {
+			arch := NewArchitecture(m.machine)
+			arch.Class = m.class
+			arch.Data = m.data
+			arch.ABIFlags = m.abiFlags
+			return arch, true
+		}
+	}
+	// Fallback to the machine name, i.e. EM_SPARCV9
+	for m := elf.EM_NONE; m <= elf.EM_LOONGARCH; m++ {
+		arch := NewArchitecture(m)
+		if arch.info() == nil && m.String() == suffix {
+			return arch, true
+		}
 	}
+	return nil, false
 }
@@ -0,0 +1,64 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"testing"
+)
+
+func TestArchitectureCounts(t *testing.T) {
+	bucket := mustArchitecture(t, "")
+	for _, flags := range []RecordType{
+		RecordTypeExecutable,
+		RecordTypeExecutable | RecordTypePIE,
+		RecordTypeExecutable | RecordTypePIE,
+		RecordTypeLibrary | RecordTypeExport,
+		RecordTypeLibrary | RecordTypeExecutable | RecordTypeExport,
+		RecordTypeLibrary | RecordTypePlugin,
+	} {
+		bucket.Records = append(bucket.Records, &Record{Flags: flags})
+	}
+	want := RecordCounts{
+		Executables:   3,
+		PIE:           2,
+		SharedObjects: 3,
+		Runnable:      1,
+		Plugins:       1,
+	}
+	if got := bucket.Counts(); got != want {
+		t.Errorf("counts %+v, want %+v", got, want)
+	}
+}
+
+func TestSortedArches(t *testing.T) {
+	var buckets []*Architecture
+	for _, suffix := range []string{"aarch64", "32", "", "x32", "ppc64le", "ppc64"} {
+		buckets = append(buckets, mustArchitecture(t, suffix))
+	}
+	report := newTestReport(buckets...)
+	for i := 0; i < 10; i++ {
+		sorted := report.SortedArches()
+		if len(sorted) != len(buckets) {
+			t.Fatalf("got %d buckets, want %d", len(sorted), len(buckets))
+		}
+		for j := 1; j < len(sorted); j++ {
+			if !sorted[j-1].Key().Less(sorted[j].Key()) {
+				t.Fatalf("%s sorted before %s", sorted[j-1].GetPathSuffix(), sorted[j].GetPathSuffix())
+			}
+		}
+	}
+}
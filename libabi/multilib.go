@@ -0,0 +1,194 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A MultilibSymbols holds the symbols of a soname that are only exported by
+// one of the two architectures.
+type MultilibSymbols struct {
+	Soname        string              // Library exported by both architectures
+	PrimaryOnly   []string            // Symbols missing from the 32-bit build
+	SecondaryOnly []string            // Symbols missing from the 64-bit build
+	Versions      []*MultilibVersions // Symbols exported with other versions
+}
+
+// A MultilibVersions holds a symbol exported by both architectures, but with
+// different version nodes, as found for glibc whose i386 build starts at
+// GLIBC_2.0 while the x86_64 build starts at GLIBC_2.2.5.
+type MultilibVersions struct {
+	Name      string   // Name of the symbol without a version
+	Primary   []string // Versioned names exported by the 64-bit build
+	Secondary []string // Versioned names exported by the 32-bit build
+}
+
+// A MultilibDiff holds the differences between the exported ABI of a 64-bit
+// architecture and its 32-bit multilib, such as x86_64 and i386.
+type MultilibDiff struct {
+	Primary       *Architecture      // The 64-bit architecture
+	Secondary     *Architecture      // The 32-bit multilib
+	PrimaryOnly   []string           // Sonames missing from the 32-bit build
+	SecondaryOnly []string           // Sonames missing from the 64-bit build
+	Symbols       []*MultilibSymbols // Symbol changes within common sonames
+}
+
+// IsEmpty will determine whether both architectures export the same ABI
+func (d *MultilibDiff) IsEmpty() bool {
+	return len(d.PrimaryOnly) == 0 && len(d.SecondaryOnly) == 0 && len(d.Symbols) == 0
+}
+
+// multilibSymbols will return the versioned names of the exported symbols
+// of the soname by their bare name. Annotations are dropped, as the size of
+// data objects such as pointers naturally differs between a 64-bit and 32-bit
+// build, and so are the versions, as the version nodes of a library may start
+// at a different release for each architecture.
+func multilibSymbols(bucket *Architecture, soname string) map[string][]string {
+	ret := make(map[string][]string)
+	for key := range bucket.Symbols[soname] {
+		symbol := ParseSymbol(key)
+		ret[symbol.Name] = append(ret[symbol.Name], symbol.VersionedName())
+	}
+	for _, names := range ret {
+		sort.Strings(names)
+	}
+	return ret
+}
+
+// multilibOnly will return the sorted versioned names of every symbol in a
+// whose name is not present in b.
+func multilibOnly(a, b map[string][]string) []string {
+	var ret []string
+	for name, versioned := range a {
+		if _, ok := b[name]; !ok {
+			ret = append(ret, versioned...)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// compareMultilib will compare the exported ABI of the two architectures,
+// also comparing the versions of the common symbols when versions is set.
+func compareMultilib(primary, secondary *Architecture, versions bool) *MultilibDiff {
+	ret := &MultilibDiff{
+		Primary:   primary,
+		Secondary: secondary,
+	}
+
+	primarySonames := stringSet(exportedSonames(primary))
+	secondarySonames := stringSet(exportedSonames(secondary))
+	ret.PrimaryOnly = setDifference(primarySonames, secondarySonames)
+	ret.SecondaryOnly = setDifference(secondarySonames, primarySonames)
+
+	for _, soname := range exportedSonames(primary) {
+		if !secondarySonames[soname] {
+			continue
+		}
+		primarySymbols := multilibSymbols(primary, soname)
+		secondarySymbols := multilibSymbols(secondary, soname)
+		sym := &MultilibSymbols{
+			Soname:        soname,
+			PrimaryOnly:   multilibOnly(primarySymbols, secondarySymbols),
+			SecondaryOnly: multilibOnly(secondarySymbols, primarySymbols),
+		}
+		if versions {
+			var names []string
+			for name := range primarySymbols {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				other, ok := secondarySymbols[name]
+				if !ok || strings.Join(primarySymbols[name], " ") == strings.Join(other, " ") {
+					continue
+				}
+				sym.Versions = append(sym.Versions, &MultilibVersions{
+					Name:      name,
+					Primary:   primarySymbols[name],
+					Secondary: other,
+				})
+			}
+		}
+		if len(sym.PrimaryOnly) > 0 || len(sym.SecondaryOnly) > 0 || len(sym.Versions) > 0 {
+			ret.Symbols = append(ret.Symbols, sym)
+		}
+	}
+	return ret
+}
+
+// CompareMultilib will compare every 32-bit multilib architecture in the
+// report with its 64-bit architecture, i.e. i386 with x86_64, and return
+// the differences found in the exported sonames and symbols. Symbols are
+// matched by name, and differences in their version nodes are only reported
+// when versions is set. Architectures without a counterpart in the report are
+// not compared.
+func CompareMultilib(report *Report, versions bool) []*MultilibDiff {
+	var keys []ArchitectureKey
+	for key := range report.Arches {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Less(keys[j]) })
+
+	var ret []*MultilibDiff
+	for _, key := range keys {
+		secondary := report.Arches[key]
+		primary, ok := secondary.MultilibOf(report)
+		if !ok {
+			continue
+		}
+		if diff := compareMultilib(primary, secondary, versions); !diff.IsEmpty() {
+			ret = append(ret, diff)
+		}
+	}
+	return ret
+}
+
+// Write will emit a human readable description of the MultilibDiff to w,
+// grouped by soname. Entries only found in the 64-bit architecture are
+// marked with "<", and those only found in the 32-bit multilib with ">".
+// Symbols exported with different versions are marked with "~".
+func (d *MultilibDiff) Write(w io.Writer) error {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "%s (suffix '%s') <> %s (suffix '%s')\n",
+		d.Primary.Machine, d.Primary.GetPathSuffix(),
+		d.Secondary.Machine, d.Secondary.GetPathSuffix())
+
+	for _, soname := range d.PrimaryOnly {
+		fmt.Fprintf(&b, "  < soname: %s\n", soname)
+	}
+	for _, soname := range d.SecondaryOnly {
+		fmt.Fprintf(&b, "  > soname: %s\n", soname)
+	}
+	for _, sym := range d.Symbols {
+		fmt.Fprintf(&b, "  %s:\n", sym.Soname)
+		writeSymbolChanges(&b, "    ", "<", sym.PrimaryOnly, ">", sym.SecondaryOnly)
+		for _, versions := range sym.Versions {
+			fmt.Fprintf(&b, "    ~ %s: %s <> %s\n", versions.Name,
+				strings.Join(versions.Primary, " "), strings.Join(versions.Secondary, " "))
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,132 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// addSymbols will add the symbols file entries of the soname to the bucket
+func addSymbols(bucket *Architecture, soname string, symbols ...string) {
+	if bucket.Symbols[soname] == nil {
+		bucket.Symbols[soname] = make(map[string]bool)
+	}
+	for _, symbol := range symbols {
+		bucket.Symbols[soname][symbol] = true
+	}
+}
+
+// newTestReport will return a report holding the buckets
+func newTestReport(buckets ...*Architecture) *Report {
+	report := &Report{Arches: make(map[ArchitectureKey]*Architecture)}
+	for _, bucket := range buckets {
+		report.Arches[bucket.Key()] = bucket
+	}
+	return report
+}
+
+func TestCompareMultilib(t *testing.T) {
+	primary := mustArchitecture(t, "")
+	secondary := mustArchitecture(t, "32")
+	addSymbols(primary, "libc.so.6",
+		"memcpy@@GLIBC_2.14",
+		"memcpy@GLIBC_2.2.5",
+		"stdout@@GLIBC_2.2.5 [OBJECT size=8]",
+		"only64@@GLIBC_2.2.5",
+	)
+	addSymbols(secondary, "libc.so.6",
+		"memcpy@@GLIBC_2.0",
+		"stdout@@GLIBC_2.0 [OBJECT size=4]",
+		"only32@@GLIBC_2.0",
+		"only32@GLIBC_2.1",
+	)
+	addSymbols(primary, "libfoo.so.1", "foo")
+	addSymbols(secondary, "libfoo.so.1", "foo")
+	addSymbols(primary, "libbar.so.1", "bar")
+	addSymbols(secondary, "libbaz.so.1", "baz")
+	report := newTestReport(primary, secondary)
+
+	diffs := CompareMultilib(report, false)
+	if len(diffs) != 1 {
+		t.Fatalf("got %d diffs, want 1", len(diffs))
+	}
+	diff := diffs[0]
+	if diff.Primary != primary || diff.Secondary != secondary {
+		t.Fatalf("compared %s with %s", diff.Primary.Machine, diff.Secondary.Machine)
+	}
+	if !reflect.DeepEqual(diff.PrimaryOnly, []string{"libbar.so.1"}) {
+		t.Errorf("primary only sonames %v", diff.PrimaryOnly)
+	}
+	if !reflect.DeepEqual(diff.SecondaryOnly, []string{"libbaz.so.1"}) {
+		t.Errorf("secondary only sonames %v", diff.SecondaryOnly)
+	}
+	want := []*MultilibSymbols{{
+		Soname:        "libc.so.6",
+		PrimaryOnly:   []string{"only64@@GLIBC_2.2.5"},
+		SecondaryOnly: []string{"only32@@GLIBC_2.0", "only32@GLIBC_2.1"},
+	}}
+	if !reflect.DeepEqual(diff.Symbols, want) {
+		t.Errorf("symbols %+v, want %+v", diff.Symbols[0], want[0])
+	}
+
+	diffs = CompareMultilib(report, true)
+	if len(diffs) != 1 || len(diffs[0].Symbols) != 1 {
+		t.Fatalf("unexpected diffs with versions")
+	}
+	wantVersions := []*MultilibVersions{
+		{"memcpy", []string{"memcpy@@GLIBC_2.14", "memcpy@GLIBC_2.2.5"}, []string{"memcpy@@GLIBC_2.0"}},
+		{"stdout", []string{"stdout@@GLIBC_2.2.5"}, []string{"stdout@@GLIBC_2.0"}},
+	}
+	if got := diffs[0].Symbols[0].Versions; !reflect.DeepEqual(got, wantVersions) {
+		t.Errorf("versions %+v, want %+v", got, wantVersions)
+	}
+
+	var b bytes.Buffer
+	if err := diffs[0].Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"  < soname: libbar.so.1\n",
+		"  > soname: libbaz.so.1\n",
+		"    < only64@@GLIBC_2.2.5\n",
+		"    > only32@GLIBC_2.1\n",
+		"    ~ memcpy: memcpy@@GLIBC_2.14 memcpy@GLIBC_2.2.5 <> memcpy@@GLIBC_2.0\n",
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("missing %q in:\n%s", line, b.String())
+		}
+	}
+}
+
+func TestCompareMultilibIdentical(t *testing.T) {
+	primary := mustArchitecture(t, "")
+	secondary := mustArchitecture(t, "32")
+	addSymbols(primary, "libc.so.6", "memcpy@@GLIBC_2.14", "stdout@@GLIBC_2.2.5 [OBJECT size=8]")
+	addSymbols(secondary, "libc.so.6", "memcpy@@GLIBC_2.0", "stdout@@GLIBC_2.0 [OBJECT size=4]")
+
+	// Only versions differ, which are ignored by default
+	if diffs := CompareMultilib(newTestReport(primary, secondary), false); len(diffs) != 0 {
+		t.Errorf("got %d diffs, want none", len(diffs))
+	}
+	// Without a 64-bit counterpart there is nothing to compare
+	if diffs := CompareMultilib(newTestReport(secondary), true); len(diffs) != 0 {
+		t.Errorf("got %d diffs, want none", len(diffs))
+	}
+}
@@ -40,15 +40,82 @@ const (
 	// RecordTypeExport is set when we encounter valid ABI, i.e. a library
 	// with a soname that we can export.
 	RecordTypeExport RecordType = 1 << iota
+
+	// RecordTypePIE indicates a position independent executable, which is
+	// an ET_DYN file just like a shared library.
+	RecordTypePIE RecordType = 1 << iota
+
+	// RecordTypePlugin indicates a shared library without a soname that
+	// cannot be run, i.e. a module loaded with dlopen()
+	RecordTypePlugin RecordType = 1 << iota
 )
 
+// recordTypeNames maps each RecordType flag to a short name
+var recordTypeNames = []struct {
+	flag RecordType
+	name string
+}{
+	{RecordTypeExecutable, "executable"},
+	{RecordTypeLibrary, "library"},
+	{RecordType64bit, "64bit"},
+	{RecordType32bit, "32bit"},
+	{RecordTypeExport, "export"},
+	{RecordTypePIE, "pie"},
+	{RecordTypePlugin, "plugin"},
+}
+
+// Names will return the short name of every flag set in the RecordType
+func (t RecordType) Names() []string {
+	var ret []string
+	for _, entry := range recordTypeNames {
+		if t&entry.flag == entry.flag {
+			ret = append(ret, entry.name)
+		}
+	}
+	return ret
+}
+
 // A Record is literally a recording of an encounter, with a file that
 // we believe to hold some interest.
 type Record struct {
-	Path         string      // Where we found the file
-	Flags        RecordType  // A bitwise set of RecordType
-	Name         string      // Either the soname or the basename
-	Dependencies []string    // DT_NEEDED dependencies
-	Symbols      []string    // Dynamic defined symbols
-	Machine      elf.Machine // Corresponding machine
+	Path         string                // Where we found the file
+	Flags        RecordType            // A bitwise set of RecordType
+	Name         string                // Either the soname or the basename
+	Dependencies []string              // DT_NEEDED dependencies
+	Symbols      []*Symbol             // Dynamic defined symbols
+	Versions     []*VersionDefinition  // Symbol versions defined by a library
+	Imports      []*Symbol             // Dynamic undefined symbols
+	Definitions  []*Symbol             // Every defined dynamic symbol, unfiltered
+	Requirements []*VersionRequirement // Symbol versions needed from libraries
+	Machine      elf.Machine           // Corresponding machine
+	Data         elf.Data              // Data encoding (endianness)
+	ABIFlags     uint32                // Processor specific flags (e_flags)
+	Variant      string                // Optimized variant subdirectory, if any
+	Signatures   map[string]string     // Function prototypes by versioned name
+	Types        map[string]string     // Layouts of the types used by the ABI
+	BuildID      string                // GNU build-id in hex, if any
+	Stripped     bool                  // No DWARF debug information within the file
+	DebugFile    string                // Separate debug file matching a stripped file
+	Package      string                // Package the file was extracted from, if known
+}
+
+// Class will return the ELF class of the record
+func (r *Record) Class() elf.Class {
+	if r.Flags&RecordType64bit == RecordType64bit {
+		return elf.ELFCLASS64
+	}
+	if r.Flags&RecordType32bit == RecordType32bit {
+		return elf.ELFCLASS32
+	}
+	return elf.ELFCLASSNONE
+}
+
+// PrimaryType will return the primary type of the record, which is
+// RecordTypeLibrary for any shared library, including those that can also be
+// run, and RecordTypeExecutable otherwise.
+func (r *Record) PrimaryType() RecordType {
+	if r.Flags&RecordTypeLibrary == RecordTypeLibrary {
+		return RecordTypeLibrary
+	}
+	return RecordTypeExecutable
 }
@@ -21,35 +21,74 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 )
 
 var (
 	// KnownExtensions is a set of filename extensions applied by the
 	// Architecture's GetPathSuffix function. We use this in our
 	// TruncateAll function.
-	KnownExtensions = []string{
-		"",
-		"32",
-	}
+	KnownExtensions = knownSuffixes()
 
 	// ReportOutputDir is where report files will be dumped to. This
 	// is set to the current working directory by default.
 	ReportOutputDir = "."
+
+	// LegacySymbols restores the symbol filtering of autospec's older
+	// abireport, which only reported unversioned, non-weak functions in
+	// .text and absolute symbols.
+	LegacySymbols = false
+
+	// Demangle adds the demangled name of C++ and Rust symbols as a tab
+	// separated column to the symbol report files, and to the symbols
+	// printed by every subcommand.
+	Demangle = false
+
+	// ReportFiles is the set of base names for the report files written
+	// per architecture, before any prefix or suffix is applied.
+	ReportFiles = []string{
+		"symbols",
+		"used_libs",
+		"used_symbols",
+		"versions",
+		"signatures",
+		"types",
+	}
 )
 
 // TruncateAll will truncate all files matching the current prefix
 // with all known extensions in abireport. We do this to ensure that
-// missing libs & reports are made obvious in git diffs.
+// missing libs & reports are made obvious in git diffs. Files with a
+// machine name suffix, i.e. symbolsEM_AARCH64 as written by older releases,
+// are truncated too.
 func TruncateAll(prefix string) error {
 	for _, ext := range KnownExtensions {
-		p1 := filepath.Join(ReportOutputDir, fmt.Sprintf("%ssymbols%s", prefix, ext))
-		p2 := filepath.Join(ReportOutputDir, fmt.Sprintf("%sused_libs%s", prefix, ext))
+		for _, name := range ReportFiles {
+			p := filepath.Join(ReportOutputDir, fmt.Sprintf("%s%s%s", prefix, name, ext))
+			if err := truncateFile(p); err != nil {
+				return err
+			}
+		}
+	}
 
-		if err := truncateFile(p1); err != nil {
-			return err
+	entries, err := os.ReadDir(ReportOutputDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
 		}
-		if err := truncateFile(p2); err != nil {
-			return err
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		for _, name := range ReportFiles {
+			if strings.HasPrefix(entry.Name(), prefix+name+"EM_") {
+				if err := truncateFile(filepath.Join(ReportOutputDir, entry.Name())); err != nil {
+					return err
+				}
+				break
+			}
 		}
 	}
 	return nil
@@ -76,44 +115,39 @@ func truncateFile(path string) error {
 	return nil
 }
 
-// writeSymbols will take care of writing out all the symbols provided by
-// the given Architecture bucket, in a $soname:$symbol mapping, sorted first
-// by soname, second by symbol.
-func (a *Report) writeSymbols(prefix string, bucket *Architecture) error {
-	suffix := bucket.GetPathSuffix()
-	symbolsPath := filepath.Join(ReportOutputDir, fmt.Sprintf("%ssymbols%s", prefix, suffix))
-
+// writeSonameMap will write out the given soname mapping in a
+// $soname:$value form, sorted first by soname, second by value.
+func writeSonameMap(path string, mapping map[string]map[string]bool) error {
 	// Grab the sonames
 	var sonames []string
-	for key := range bucket.Symbols {
+	for key := range mapping {
 		sonames = append(sonames, key)
 	}
 	sort.Strings(sonames)
 
 	if len(sonames) < 1 {
 		// Truncate the file if it did exist.
-		if err := truncateFile(symbolsPath); err != nil {
+		if err := truncateFile(path); err != nil {
 			return err
 		}
 		return nil
 	}
 
-	// The symbols file
-	symsFi, err := os.Create(symbolsPath)
+	fi, err := os.Create(path)
 	if err != nil {
 		return err
 	}
-	defer symsFi.Close()
+	defer fi.Close()
 
-	// Emit soname:symbol mapping
+	// Emit soname:value mapping
 	for _, soname := range sonames {
-		var foundSymbols []string
-		for symbol := range bucket.Symbols[soname] {
-			foundSymbols = append(foundSymbols, symbol)
+		var values []string
+		for value := range mapping[soname] {
+			values = append(values, value)
 		}
-		sort.Strings(foundSymbols)
-		for _, symbol := range foundSymbols {
-			if _, err = fmt.Fprintf(symsFi, "%s:%s\n", soname, symbol); err != nil {
+		sort.Strings(values)
+		for _, value := range values {
+			if _, err = fmt.Fprintf(fi, "%s:%s\n", soname, value); err != nil {
 				return err
 			}
 		}
@@ -121,27 +155,59 @@ func (a *Report) writeSymbols(prefix string, bucket *Architecture) error {
 	return nil
 }
 
+// writeSymbols will take care of writing out all the symbols provided by
+// the given Architecture bucket, in a $soname:$symbol mapping, sorted first
+// by soname, second by symbol.
+func (a *Report) writeSymbols(prefix string, bucket *Architecture) error {
+	suffix := bucket.GetPathSuffix()
+	symbolsPath := filepath.Join(ReportOutputDir, fmt.Sprintf("%ssymbols%s", prefix, suffix))
+	return writeSonameMap(symbolsPath, demangleSonameMap(bucket.Symbols))
+}
+
+// writeVersions will write out the version definition tree of each exported
+// soname in a $soname:$version mapping, where $version may be followed by
+// a list of the versions it inherits from.
+func (a *Report) writeVersions(prefix string, bucket *Architecture) error {
+	suffix := bucket.GetPathSuffix()
+	versionsPath := filepath.Join(ReportOutputDir, fmt.Sprintf("%sversions%s", prefix, suffix))
+	return writeSonameMap(versionsPath, bucket.Versions)
+}
+
+// writeSignatures will write out the prototype of every exported function
+// with debug information in a $soname:$symbol:$prototype mapping. The file is
+// only written when debug information was found.
+func (a *Report) writeSignatures(prefix string, bucket *Architecture) error {
+	suffix := bucket.GetPathSuffix()
+	signaturesPath := filepath.Join(ReportOutputDir, fmt.Sprintf("%ssignatures%s", prefix, suffix))
+	return writeSonameMap(signaturesPath, bucket.Signatures)
+}
+
+// writeTypes will write out the layout of every type used by the exported
+// functions and data objects in a $soname:$type = $layout mapping. The file is
+// only written when debug information was found.
+func (a *Report) writeTypes(prefix string, bucket *Architecture) error {
+	suffix := bucket.GetPathSuffix()
+	typesPath := filepath.Join(ReportOutputDir, fmt.Sprintf("%stypes%s", prefix, suffix))
+	return writeSonameMap(typesPath, bucket.Types)
+}
+
+// writeUsedSymbols will write out the symbols that this architecture bucket
+// consumes from outside of the scanned set, in a $soname:$symbol mapping as
+// determined by UsedSymbols.
+func (a *Report) writeUsedSymbols(prefix string, bucket *Architecture) error {
+	suffix := bucket.GetPathSuffix()
+	usedPath := filepath.Join(ReportOutputDir, fmt.Sprintf("%sused_symbols%s", prefix, suffix))
+	return writeSonameMap(usedPath, demangleSonameMap(bucket.UsedSymbols()))
+}
+
 // writeDeps will write out a sorted list of soname's that this architecture
-// bucket depends on.
-// It will also filter out the names that are provided to generate a true
-// reported based on DT_NEEDED requirements.
+// bucket depends on, as determined by UsedLibs.
 func (a *Report) writeDeps(prefix string, bucket *Architecture) error {
 	suffix := bucket.GetPathSuffix()
 	depsPath := filepath.Join(ReportOutputDir, fmt.Sprintf("%sused_libs%s", prefix, suffix))
 
 	// Emit dependencies
-	var depNames []string
-	for nom := range bucket.Dependencies {
-		// Skip provided
-		if _, ok := bucket.Symbols[nom]; ok {
-			continue
-		}
-		if _, ok := bucket.HiddenSymbols[nom]; ok {
-			continue
-		}
-		depNames = append(depNames, nom)
-	}
-	sort.Strings(depNames)
+	depNames := bucket.UsedLibs()
 
 	if len(depNames) < 1 {
 		if err := truncateFile(depsPath); err != nil {
@@ -172,6 +238,19 @@ func (a *Report) Report(prefix string, bucket *Architecture) error {
 	if err := a.writeSymbols(prefix, bucket); err != nil {
 		return err
 	}
+	if err := a.writeVersions(prefix, bucket); err != nil {
+		return err
+	}
+	if err := a.writeSignatures(prefix, bucket); err != nil {
+		return err
+	}
+	if err := a.writeTypes(prefix, bucket); err != nil {
+		return err
+	}
+
+	if err := a.writeUsedSymbols(prefix, bucket); err != nil {
+		return err
+	}
 
 	return a.writeDeps(prefix, bucket)
 }
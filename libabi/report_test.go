@@ -0,0 +1,57 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTruncateAll(t *testing.T) {
+	dir := t.TempDir()
+	oldDir := ReportOutputDir
+	ReportOutputDir = dir
+	defer func() { ReportOutputDir = oldDir }()
+
+	files := map[string]bool{
+		"pkg_symbols":              true,
+		"pkg_used_libs32":          true,
+		"pkg_symbolsEM_AARCH64":    true,
+		"pkg_used_symbolsEM_PPC64": true,
+		"pkg_notes":                false,
+		"other_symbolsEM_AARCH64":  false,
+	}
+	for name := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("libfoo.so.1:foo\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := TruncateAll("pkg_"); err != nil {
+		t.Fatal(err)
+	}
+	for name, truncated := range files {
+		st, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := st.Size() == 0; got != truncated {
+			t.Errorf("%s: truncated = %v, want %v", name, got, truncated)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymlinks is the number of symlinks followed before giving up, which
+// matches the Linux limit.
+const maxSymlinks = 40
+
+// A Resolver emulates the dynamic loader to locate the libraries needed by
+// a binary within a root directory, without ever looking outside of it.
+type Resolver struct {
+	Root    string   // Root directory that we're resolving in
+	LibDirs []string // Directories from ld.so.conf, relative to the root
+}
+
+// A ResolvedLibrary is a node in the dependency tree of a binary. All
+// paths are relative to the root of the Resolver.
+type ResolvedLibrary struct {
+	Name   string             // Name as found in DT_NEEDED
+	Path   string             // Where the library was found, if at all
+	Needed []*ResolvedLibrary // Resolved DT_NEEDED entries
+}
+
+// Missing will determine if the library could not be found
+func (l *ResolvedLibrary) Missing() bool {
+	return l.Path == ""
+}
+
+// resolveState holds the loader state while resolving a single binary
+type resolveState struct {
+	arch   *Architecture               // Architecture of the main binary
+	loaded map[string]*ResolvedLibrary // Libraries loaded so far, by name
+}
+
+// A resolveJob is a pending library whose dependencies need resolving,
+// along with the DT_RPATH entries inherited from the objects loading it.
+type resolveJob struct {
+	lib    *ResolvedLibrary
+	rpaths []string
+}
+
+// NewResolver will create a new Resolver for the root, using the library
+// directories configured in the root's /etc/ld.so.conf.
+func NewResolver(root string) (*Resolver, error) {
+	absPath, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := ParseLdSoConf(absPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Resolver{
+		Root:    absPath,
+		LibDirs: dirs,
+	}, nil
+}
+
+// hostPath will return the real location of a path within the root
+func (r *Resolver) hostPath(p string) string {
+	return filepath.Join(r.Root, p)
+}
+
+// RealPath will resolve all symlinks in the path as though the root was
+// the real root directory, so that absolute links never escape it.
+func (r *Resolver) RealPath(p string) (string, error) {
+	pending := strings.Split(filepath.Clean("/"+p), "/")
+	current := "/"
+	links := 0
+
+	for len(pending) > 0 {
+		component := pending[0]
+		pending = pending[1:]
+		if component == "" || component == "." {
+			continue
+		}
+		if component == ".." {
+			current = filepath.Dir(current)
+			continue
+		}
+
+		next := filepath.Join(current, component)
+		st, err := os.Lstat(r.hostPath(next))
+		if err != nil {
+			return "", err
+		}
+		if st.Mode()&os.ModeSymlink != os.ModeSymlink {
+			current = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", p)
+		}
+		target, err := os.Readlink(r.hostPath(next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			current = "/"
+		}
+		pending = append(strings.Split(target, "/"), pending...)
+	}
+	return current, nil
+}
+
+// expandPaths will split a DT_RPATH or DT_RUNPATH value and expand the
+// dynamic string tokens within it for an object living in origin.
+func (st *resolveState) expandPaths(values []string, origin string) []string {
+	var ret []string
+	replacer := strings.NewReplacer(
+		"${ORIGIN}", origin,
+		"$ORIGIN", origin,
+		"${LIB}", st.arch.LibName(),
+		"$LIB", st.arch.LibName(),
+		"${PLATFORM}", st.arch.Platform(),
+		"$PLATFORM", st.arch.Platform(),
+	)
+	for _, value := range values {
+		for _, dir := range strings.Split(value, ":") {
+			if dir == "" {
+				continue
+			}
+			ret = append(ret, filepath.Clean(replacer.Replace(dir)))
+		}
+	}
+	return ret
+}
+
+// isCompatible will determine if the file at p can be loaded into the
+// binary being resolved. Incompatible libraries are skipped by the loader.
+func (r *Resolver) isCompatible(st *resolveState, p string) bool {
+	real, err := r.RealPath(p)
+	if err != nil {
+		return false
+	}
+	arch, typ, err := architectureOf(r.hostPath(real))
+	if err != nil {
+		return false
+	}
+	return typ == elf.ET_DYN && arch.Class == st.arch.Class && arch.Data == st.arch.Data &&
+		arch.Machine == st.arch.Machine && arch.GetPathSuffix() == st.arch.GetPathSuffix()
+}
+
+// search will look for the named library in each of the directories
+func (r *Resolver) search(st *resolveState, name string, dirs []string) string {
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, name)
+		if r.isCompatible(st, candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// Resolve will emulate the dynamic loader for the binary at p, relative to
+// the root, and return the resolved dependency tree. Each library is only
+// loaded once, so later references to the same name share the first node.
+//
+// Libraries are searched for in DT_RPATH of the loading chain (unless the
+// loading object has DT_RUNPATH), DT_RUNPATH, the ld.so.conf directories,
+// and finally the default trusted directories. Dynamic string tokens such as
+// $ORIGIN, $LIB and $PLATFORM are expanded for the loading object.
+func (r *Resolver) Resolve(p string) (*ResolvedLibrary, error) {
+	real, err := r.RealPath(p)
+	if err != nil {
+		return nil, err
+	}
+	arch, _, err := architectureOf(r.hostPath(real))
+	if err != nil {
+		return nil, err
+	}
+	st := &resolveState{
+		arch:   arch,
+		loaded: make(map[string]*ResolvedLibrary),
+	}
+
+	top := &ResolvedLibrary{Name: filepath.Base(p), Path: filepath.Clean("/" + p)}
+	queue := []*resolveJob{{lib: top}}
+
+	for len(queue) > 0 {
+		job := queue[0]
+		queue = queue[1:]
+
+		real, err := r.RealPath(job.lib.Path)
+		if err != nil {
+			return nil, err
+		}
+		file, err := elf.Open(r.hostPath(real))
+		if err != nil {
+			return nil, err
+		}
+		needed, err := file.DynString(elf.DT_NEEDED)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		rpath, _ := file.DynString(elf.DT_RPATH)
+		runpath, _ := file.DynString(elf.DT_RUNPATH)
+		file.Close()
+
+		// $ORIGIN is the directory of the object after resolving links.
+		// When DT_RUNPATH is present, only it is searched. Otherwise the
+		// DT_RPATH of this object is searched, followed by that of each
+		// object in the loading chain.
+		origin := filepath.Dir(real)
+		rpaths := job.rpaths
+		var searchPaths []string
+		if len(runpath) > 0 {
+			searchPaths = st.expandPaths(runpath, origin)
+		} else {
+			rpaths = append(st.expandPaths(rpath, origin), job.rpaths...)
+			searchPaths = rpaths
+		}
+
+		for _, name := range needed {
+			if lib, ok := st.loaded[name]; ok {
+				job.lib.Needed = append(job.lib.Needed, lib)
+				continue
+			}
+
+			lib := &ResolvedLibrary{Name: name}
+			if strings.Contains(name, "/") {
+				if r.isCompatible(st, name) {
+					lib.Path = filepath.Clean("/" + name)
+				}
+			} else {
+				for _, dirs := range [][]string{searchPaths, r.LibDirs, st.arch.DefaultLibDirs()} {
+					if lib.Path = r.search(st, name, dirs); lib.Path != "" {
+						break
+					}
+				}
+			}
+
+			st.loaded[name] = lib
+			job.lib.Needed = append(job.lib.Needed, lib)
+			if !lib.Missing() {
+				// DT_RUNPATH is never inherited, but DT_RPATH is
+				queue = append(queue, &resolveJob{lib: lib, rpaths: rpaths})
+			}
+		}
+	}
+	return top, nil
+}
@@ -0,0 +1,193 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// symlinkFixture will create the symlink at name within root
+func symlinkFixture(t *testing.T, root, name, target string) {
+	t.Helper()
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolverRealPath(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "usr/lib64/libreal.so.1", "")
+	writeTestFile(t, root, "etc/passwd", "")
+	symlinkFixture(t, root, "lib64", "usr/lib64")
+	symlinkFixture(t, root, "usr/lib64/libabs.so.1", "/usr/lib64/libreal.so.1")
+	symlinkFixture(t, root, "usr/lib64/librel.so.1", "libreal.so.1")
+	symlinkFixture(t, root, "usr/lib64/libchain.so", "/lib64/librel.so.1")
+	symlinkFixture(t, root, "usr/lib64/escape", "../../../../../../../../etc/passwd")
+	symlinkFixture(t, root, "usr/lib64/etc", "/etc")
+	symlinkFixture(t, root, "usr/lib64/host", "/bin/sh")
+	symlinkFixture(t, root, "loop1", "loop2")
+	symlinkFixture(t, root, "loop2", "/loop1")
+
+	tests := []struct {
+		path string
+		want string // Empty when an error is expected
+	}{
+		{"/usr/lib64/libreal.so.1", "/usr/lib64/libreal.so.1"},
+		{"/usr/lib64/libabs.so.1", "/usr/lib64/libreal.so.1"},
+		{"/usr/lib64/librel.so.1", "/usr/lib64/libreal.so.1"},
+		{"/lib64/libreal.so.1", "/usr/lib64/libreal.so.1"},
+		{"/usr/lib64/libchain.so", "/usr/lib64/libreal.so.1"},
+		{"usr/lib64/../lib64/libreal.so.1", "/usr/lib64/libreal.so.1"},
+		// Neither .. nor absolute links may leave the root
+		{"/../../../etc/passwd", "/etc/passwd"},
+		{"/usr/lib64/escape", "/etc/passwd"},
+		{"/usr/lib64/etc/passwd", "/etc/passwd"},
+		{"/usr/lib64/host", ""},
+		{"/usr/lib64/missing.so", ""},
+		{"/loop1", ""},
+	}
+	r := &Resolver{Root: root}
+	for _, test := range tests {
+		got, err := r.RealPath(test.path)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: resolved to %s, want an error", test.path, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+		} else if got != test.want {
+			t.Errorf("%s: resolved to %s, want %s", test.path, got, test.want)
+		}
+	}
+}
+
+// sharedFixture will build a shared object at path within root with the
+// given soname and DT_NEEDED entries. Stub libraries are built outside of
+// the root to satisfy the link, using the same extra arguments.
+func sharedFixture(t *testing.T, root, path, soname string, needed []string, args ...string) {
+	t.Helper()
+	stubs := t.TempDir()
+	var objects []string
+	for _, name := range needed {
+		stub := filepath.Join(stubs, name)
+		compileWith(t, "gcc", "stub.c", "void stub(void) {}\n", append([]string{
+			"-shared", "-nostdlib", "-fPIC", "-Wl,-soname," + name, "-o", stub}, args...)...)
+		objects = append(objects, stub)
+	}
+	out := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		t.Fatal(err)
+	}
+	flags := append([]string{"-shared", "-nostdlib", "-fPIC", "-Wl,--no-as-needed", "-o", out}, args...)
+	if soname != "" {
+		flags = append(flags, "-Wl,-soname,"+soname)
+	}
+	compileWith(t, "gcc", "fixture.c", "int fixture(void) { return 0; }\n", append(flags, objects...)...)
+}
+
+// resolvedPaths will flatten the dependency tree into the path each library
+// name was resolved to, which is empty when it is missing.
+func resolvedPaths(lib *ResolvedLibrary, ret map[string]string) map[string]string {
+	for _, dep := range lib.Needed {
+		if _, ok := ret[dep.Name]; ok {
+			continue
+		}
+		ret[dep.Name] = dep.Path
+		resolvedPaths(dep, ret)
+	}
+	return ret
+}
+
+func TestResolverResolve(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "etc/ld.so.conf", "/usr/local/lib64\n")
+
+	sharedFixture(t, root, "opt/a/libtwo.so", "libtwo.so", nil)
+	sharedFixture(t, root, "opt/a/libone.so", "libone.so", []string{"libtwo.so"})
+	sharedFixture(t, root, "usr/local/lib64/libone.so", "libone.so", nil)
+	sharedFixture(t, root, "usr/lib64/app/libthree.so", "libthree.so", nil)
+	sharedFixture(t, root, "opt/x86_64/libfour.so", "libfour.so", nil)
+	sharedFixture(t, root, "usr/lib64/libdep.so", "libdep.so", nil)
+	sharedFixture(t, root, "usr/lib/libdep.so", "libdep.so", nil, "-m32")
+	// Not an ELF file, which the loader skips
+	writeTestFile(t, root, "opt/bad/libdep.so", "not a library")
+
+	sharedFixture(t, root, "usr/bin/plain", "", []string{"libone.so"})
+	sharedFixture(t, root, "usr/bin/rpath", "", []string{"libone.so"},
+		"-Wl,--disable-new-dtags,-rpath,/opt/a")
+	sharedFixture(t, root, "usr/bin/runpath", "", []string{"libone.so"},
+		"-Wl,--enable-new-dtags,-rpath,/opt/a")
+	sharedFixture(t, root, "opt/a/bin/origin", "", []string{"libtwo.so"},
+		"-Wl,--enable-new-dtags,-rpath,$ORIGIN/..")
+	symlinkFixture(t, root, "usr/bin/origin", "/opt/a/bin/origin")
+	sharedFixture(t, root, "usr/bin/tokens", "", []string{"libthree.so", "libfour.so"},
+		"-Wl,--enable-new-dtags,-rpath,/usr/${LIB}/app:/opt/$PLATFORM")
+	sharedFixture(t, root, "usr/bin/dep64", "", []string{"libdep.so"},
+		"-Wl,--enable-new-dtags,-rpath,/opt/bad:/usr/lib")
+	sharedFixture(t, root, "usr/bin/dep32", "", []string{"libdep.so"}, "-m32")
+
+	tests := []struct {
+		path string
+		want map[string]string
+	}{
+		// ld.so.conf is searched when there is no DT_RPATH or DT_RUNPATH
+		{"/usr/bin/plain", map[string]string{"libone.so": "/usr/local/lib64/libone.so"}},
+		// DT_RPATH comes first, and is inherited by indirect dependencies
+		{"/usr/bin/rpath", map[string]string{
+			"libone.so": "/opt/a/libone.so",
+			"libtwo.so": "/opt/a/libtwo.so",
+		}},
+		// DT_RUNPATH comes first, but only for the object's own needs
+		{"/usr/bin/runpath", map[string]string{
+			"libone.so": "/opt/a/libone.so",
+			"libtwo.so": "",
+		}},
+		// $ORIGIN is the directory of the object once links are resolved
+		{"/usr/bin/origin", map[string]string{"libtwo.so": "/opt/a/libtwo.so"}},
+		{"/usr/bin/tokens", map[string]string{
+			"libthree.so": "/usr/lib64/app/libthree.so",
+			"libfour.so":  "/opt/x86_64/libfour.so",
+		}},
+		// Invalid and 32-bit candidates are skipped for the default dirs
+		{"/usr/bin/dep64", map[string]string{"libdep.so": "/usr/lib64/libdep.so"}},
+		{"/usr/bin/dep32", map[string]string{"libdep.so": "/usr/lib/libdep.so"}},
+	}
+
+	r, err := NewResolver(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		top, err := r.Resolve(test.path)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if got := resolvedPaths(top, make(map[string]string)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: resolved %v, want %v", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/elf"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// stbGNUUnique is the STB_GNU_UNIQUE binding, used for C++ inline
+	// statics and template members that must be unique in the process.
+	stbGNUUnique = elf.STB_LOOS
+
+	// sttGNUIFunc is the STT_GNU_IFUNC type, used for functions resolved
+	// at runtime, such as the optimized string functions of glibc.
+	sttGNUIFunc = elf.STT_LOOS
+)
+
+// sizedTypes are the symbol types whose size is part of the ABI, as a change
+// in size breaks consumers using copy relocations.
+var sizedTypes = map[elf.SymType]string{
+	elf.STT_OBJECT: "OBJECT",
+	elf.STT_TLS:    "TLS",
+	elf.STT_COMMON: "COMMON",
+}
+
+// A Symbol is a single dynamic symbol encountered within a Record
+type Symbol struct {
+	Name       string      // Name of the symbol, without any version
+	Version    string      // GNU symbol version, if any
+	Hidden     bool        // Version is hidden, i.e. a compat symbol
+	Undefined  bool        // Symbol is imported rather than defined
+	Library    string      // Library the version is required from, if known
+	Binding    elf.SymBind // ELF symbol binding
+	Type       elf.SymType // ELF symbol type
+	Visibility elf.SymVis  // ELF symbol visibility
+	Size       uint64      // Size of the symbol (st_size)
+	Value      uint64      // Address of the symbol (st_value), if defined
+}
+
+// VersionedName will return the name of the symbol with its version, using
+// the same notation as the GNU tools, i.e. memcpy@@GLIBC_2.14 for the default
+// version and memcpy@GLIBC_2.2.5 for a hidden (compat) version. References to
+// a versioned symbol always use the memcpy@GLIBC_2.14 form.
+func (s *Symbol) VersionedName() string {
+	if s.Version == "" {
+		return s.Name
+	}
+	if s.Hidden || s.Undefined {
+		return s.Name + "@" + s.Version
+	}
+	return s.Name + "@@" + s.Version
+}
+
+// Annotations will return the attributes of a defined symbol that differ
+// from a plain global function with default visibility. Data objects are
+// annotated with their type and size, as a change in size breaks consumers
+// using copy relocations. Objects without a size, such as the absolute
+// symbols naming each version node, have no size to annotate.
+func (s *Symbol) Annotations() []string {
+	var ret []string
+	if typeName, ok := sizedTypes[s.Type]; ok && s.Size > 0 {
+		ret = append(ret, typeName, fmt.Sprintf("size=%d", s.Size))
+	}
+	if s.Type == sttGNUIFunc {
+		ret = append(ret, "IFUNC")
+	}
+	switch s.Binding {
+	case elf.STB_WEAK:
+		ret = append(ret, "WEAK")
+	case stbGNUUnique:
+		ret = append(ret, "UNIQUE")
+	}
+	if s.Visibility == elf.STV_PROTECTED {
+		ret = append(ret, "PROTECTED")
+	}
+	return ret
+}
+
+// String will return the symbol as used in reports, which is the versioned
+// name followed by any annotations in brackets, i.e. for an exported data
+// object stdout@@GLIBC_2.2.5 [OBJECT size=8], or memcpy@@GLIBC_2.14 [IFUNC]
+func (s *Symbol) String() string {
+	name := s.VersionedName()
+	if s.Undefined {
+		return name
+	}
+	if annotations := s.Annotations(); len(annotations) > 0 {
+		return name + " [" + strings.Join(annotations, " ") + "]"
+	}
+	return name
+}
+
+// A VersionDefinition is a single node in the version definition tree of
+// a library, as found in the .gnu.version_d section.
+type VersionDefinition struct {
+	Name    string   // Name of the version node, i.e. GLIBC_2.14
+	Parents []string // Versions this node inherits from
+}
+
+// String will return the version node as used in reports, which is the
+// name followed by a comma separated list of parents, if any.
+func (v *VersionDefinition) String() string {
+	if len(v.Parents) == 0 {
+		return v.Name
+	}
+	return v.Name + ":" + strings.Join(v.Parents, ",")
+}
+
+// A VersionRequirement is a set of versions that a binary requires from
+// a library, as found in the .gnu.version_r section.
+type VersionRequirement struct {
+	Library  string   // Library the versions are required from
+	Versions []string // Names of the required versions, i.e. GLIBC_2.34
+}
+
+// ParseSymbol is the inverse of Symbol.String, and will reconstruct a
+// defined Symbol from the name used in a symbols report.
+func ParseSymbol(name string) *Symbol {
+	symbol := &Symbol{Type: elf.STT_FUNC, Binding: elf.STB_GLOBAL}
+
+	// Split off the annotations
+	if idx := strings.Index(name, " ["); idx > 0 && strings.HasSuffix(name, "]") {
+		for _, field := range strings.Fields(name[idx+2 : len(name)-1]) {
+			if strings.HasPrefix(field, "size=") {
+				symbol.Size, _ = strconv.ParseUint(field[5:], 10, 64)
+				continue
+			}
+			switch field {
+			case "IFUNC":
+				symbol.Type = sttGNUIFunc
+			case "WEAK":
+				symbol.Binding = elf.STB_WEAK
+			case "UNIQUE":
+				symbol.Binding = stbGNUUnique
+			case "PROTECTED":
+				symbol.Visibility = elf.STV_PROTECTED
+			}
+			for symType, typeName := range sizedTypes {
+				if field == typeName {
+					symbol.Type = symType
+				}
+			}
+		}
+		name = name[:idx]
+	}
+
+	if idx := strings.Index(name, "@@"); idx > 0 {
+		symbol.Name, symbol.Version = name[:idx], name[idx+2:]
+	} else if idx := strings.Index(name, "@"); idx > 0 {
+		symbol.Name, symbol.Version, symbol.Hidden = name[:idx], name[idx+1:], true
+	} else {
+		symbol.Name = name
+	}
+	return symbol
+}
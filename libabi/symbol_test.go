@@ -0,0 +1,96 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"debug/elf"
+	"reflect"
+	"testing"
+)
+
+func TestSymbolRoundTrip(t *testing.T) {
+	tests := []struct {
+		symbol Symbol
+		want   string
+	}{
+		{
+			Symbol{Name: "foo", Type: elf.STT_FUNC, Binding: elf.STB_GLOBAL},
+			"foo",
+		},
+		{
+			Symbol{Name: "memcpy", Version: "GLIBC_2.14", Type: elf.STT_FUNC, Binding: elf.STB_GLOBAL},
+			"memcpy@@GLIBC_2.14",
+		},
+		{
+			Symbol{Name: "memcpy", Version: "GLIBC_2.2.5", Hidden: true, Type: elf.STT_FUNC, Binding: elf.STB_GLOBAL},
+			"memcpy@GLIBC_2.2.5",
+		},
+		{
+			Symbol{Name: "stdout", Version: "GLIBC_2.2.5", Type: elf.STT_OBJECT, Binding: elf.STB_GLOBAL, Size: 8},
+			"stdout@@GLIBC_2.2.5 [OBJECT size=8]",
+		},
+		{
+			Symbol{Name: "errno_tls", Type: elf.STT_TLS, Binding: elf.STB_GLOBAL, Size: 4},
+			"errno_tls [TLS size=4]",
+		},
+		{
+			Symbol{Name: "common", Type: elf.STT_COMMON, Binding: elf.STB_GLOBAL, Size: 16},
+			"common [COMMON size=16]",
+		},
+		{
+			Symbol{Name: "strlen", Version: "GLIBC_2.2.5", Type: sttGNUIFunc, Binding: elf.STB_GLOBAL},
+			"strlen@@GLIBC_2.2.5 [IFUNC]",
+		},
+		{
+			Symbol{Name: "foo_weak", Type: elf.STT_FUNC, Binding: elf.STB_WEAK},
+			"foo_weak [WEAK]",
+		},
+		{
+			Symbol{Name: "_ZN3Foo8instanceE", Type: elf.STT_OBJECT, Binding: stbGNUUnique, Size: 8},
+			"_ZN3Foo8instanceE [OBJECT size=8 UNIQUE]",
+		},
+		{
+			Symbol{Name: "foo_protected", Type: elf.STT_FUNC, Binding: elf.STB_GLOBAL, Visibility: elf.STV_PROTECTED},
+			"foo_protected [PROTECTED]",
+		},
+		{
+			Symbol{Name: "environ", Version: "GLIBC_2.2.5", Hidden: true, Type: elf.STT_OBJECT, Binding: elf.STB_WEAK, Visibility: elf.STV_PROTECTED, Size: 8},
+			"environ@GLIBC_2.2.5 [OBJECT size=8 WEAK PROTECTED]",
+		},
+		{
+			Symbol{Name: "memset", Version: "GLIBC_2.2.5", Type: sttGNUIFunc, Binding: elf.STB_WEAK, Visibility: elf.STV_PROTECTED},
+			"memset@@GLIBC_2.2.5 [IFUNC WEAK PROTECTED]",
+		},
+	}
+	for _, test := range tests {
+		symbol := test.symbol
+		if got := symbol.String(); got != test.want {
+			t.Errorf("String() = %q, want %q", got, test.want)
+		}
+		if got := ParseSymbol(symbol.String()); !reflect.DeepEqual(got, &symbol) {
+			t.Errorf("ParseSymbol(%q) = %+v, want %+v", test.want, got, symbol)
+		}
+	}
+}
+
+func TestSymbolUndefined(t *testing.T) {
+	// References never use @@, nor carry annotations
+	symbol := &Symbol{Name: "stdout", Version: "GLIBC_2.2.5", Undefined: true, Type: elf.STT_OBJECT, Size: 8}
+	if got := symbol.String(); got != "stdout@GLIBC_2.2.5" {
+		t.Errorf("String() = %q, want stdout@GLIBC_2.2.5", got)
+	}
+}
@@ -0,0 +1,151 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OptimizedVariants is the set of subdirectories of a library directory that
+// hold optimized builds of the same libraries, as shipped by Clear Linux.
+// Subdirectories of glibc-hwcaps are always treated as optimized variants.
+var OptimizedVariants = []string{
+	"haswell",
+	"haswell/avx512_1",
+}
+
+// VariantProblemKind describes how an optimized variant differs from the
+// baseline build of the library.
+type VariantProblemKind int
+
+const (
+	// VariantNoBaseline means the variant has no baseline build at all
+	VariantNoBaseline VariantProblemKind = iota
+
+	// VariantAddedSymbol is a symbol only exported by the variant
+	VariantAddedSymbol
+
+	// VariantRemovedSymbol is a symbol not exported by the variant
+	VariantRemovedSymbol
+
+	// VariantAddedDependency is a library only needed by the variant
+	VariantAddedDependency
+
+	// VariantRemovedDependency is a library not needed by the variant
+	VariantRemovedDependency
+)
+
+// String will return a human readable description of the problem kind
+func (k VariantProblemKind) String() string {
+	switch k {
+	case VariantNoBaseline:
+		return "no baseline"
+	case VariantAddedSymbol:
+		return "extra symbol"
+	case VariantRemovedSymbol:
+		return "missing symbol"
+	case VariantAddedDependency:
+		return "extra dependency"
+	case VariantRemovedDependency:
+		return "missing dependency"
+	default:
+		return "unknown"
+	}
+}
+
+// A VariantProblem is a single difference between an optimized variant of a
+// library and its baseline build.
+type VariantProblem struct {
+	Kind     VariantProblemKind
+	Record   *Record // The optimized variant
+	Baseline *Record // The baseline build, nil for VariantNoBaseline
+	Value    string  // The symbol or soname that differs
+}
+
+// variantKey will return the key used to match a library with its variants,
+// which is the library directory and the name of the library.
+func variantKey(record *Record) string {
+	dir := strings.TrimSuffix(filepath.Dir(record.Path), "/"+record.Variant)
+	return dir + "\x00" + record.Name
+}
+
+// compareVariant will append a problem for every value only found in one of
+// the two sets, using the added kind for values only found in the variant.
+func compareVariant(ret []*VariantProblem, variant, baseline *Record, variantSet, baseSet map[string]bool, added, removed VariantProblemKind) []*VariantProblem {
+	for _, value := range setDifference(variantSet, baseSet) {
+		ret = append(ret, &VariantProblem{Kind: added, Record: variant, Baseline: baseline, Value: value})
+	}
+	for _, value := range setDifference(baseSet, variantSet) {
+		ret = append(ret, &VariantProblem{Kind: removed, Record: variant, Baseline: baseline, Value: value})
+	}
+	return ret
+}
+
+// CheckVariants will compare every optimized variant of a library, such as
+// those in glibc-hwcaps/x86-64-v3 or haswell, with the baseline build in the
+// library directory above it. A variant must export exactly the same symbols
+// and need exactly the same libraries, as the dynamic loader may pick either
+// of them at runtime.
+func (a *Architecture) CheckVariants() []*VariantProblem {
+	var ret []*VariantProblem
+
+	baselines := make(map[string]*Record)
+	for _, record := range a.Records {
+		if record.Variant == "" && record.Flags&RecordTypeExport == RecordTypeExport {
+			baselines[variantKey(record)] = record
+		}
+	}
+
+	for _, record := range a.Records {
+		if record.Variant == "" || record.Flags&RecordTypeLibrary != RecordTypeLibrary {
+			continue
+		}
+		baseline, ok := baselines[variantKey(record)]
+		if !ok {
+			ret = append(ret, &VariantProblem{Kind: VariantNoBaseline, Record: record, Value: record.Name})
+			continue
+		}
+		ret = compareVariant(ret, record, baseline, symbolSet(record), symbolSet(baseline),
+			VariantAddedSymbol, VariantRemovedSymbol)
+		ret = compareVariant(ret, record, baseline, stringSet(record.Dependencies), stringSet(baseline.Dependencies),
+			VariantAddedDependency, VariantRemovedDependency)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Record.Path != ret[j].Record.Path {
+			return ret[i].Record.Path < ret[j].Record.Path
+		}
+		return ret[i].Kind < ret[j].Kind
+	})
+	return ret
+}
+
+// symbolSet will return the exported symbols of the record, as they would
+// be written to the symbols file.
+func symbolSet(record *Record) map[string]bool {
+	ret := make(map[string]bool)
+	for _, symbol := range record.Symbols {
+		if LegacySymbols {
+			ret[symbol.Name] = true
+		} else {
+			ret[symbol.String()] = true
+		}
+	}
+	return ret
+}
@@ -0,0 +1,69 @@
+//
+// Copyright © 2016-2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package libabi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckVariantsListedLibDir(t *testing.T) {
+	root := t.TempDir()
+	libDir := filepath.Join(root, "usr", "lib64")
+	variantDir := filepath.Join(libDir, "haswell")
+	confDir := filepath.Join(root, "etc")
+	for _, dir := range []string{variantDir, confDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Registering the variant with the loader must not make it a baseline
+	if err := os.WriteFile(filepath.Join(confDir, "ld.so.conf"), []byte("/usr/lib64/haswell\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	compileFixture(t, "int foo(void) { return 0; }\n",
+		"-shared", "-fPIC", "-Wl,-soname,libfoo.so.1", "-o", filepath.Join(libDir, "libfoo.so.1"))
+	compileFixture(t, "int foo(void) { return 0; }\nint foo_fast(void) { return 1; }\n",
+		"-shared", "-fPIC", "-Wl,-soname,libfoo.so.1", "-o", filepath.Join(variantDir, "libfoo.so.1"))
+
+	report, err := NewReport(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Walk(); err != nil {
+		t.Fatal(err)
+	}
+
+	var problems []*VariantProblem
+	for _, arch := range report.Arches {
+		if symbols, ok := arch.Symbols["libfoo.so.1"]; ok && symbols["foo_fast"] {
+			t.Errorf("variant symbols were exported")
+		}
+		problems = append(problems, arch.CheckVariants()...)
+	}
+	if len(problems) != 1 || problems[0].Kind != VariantAddedSymbol || problems[0].Value != "foo_fast" {
+		for _, problem := range problems {
+			t.Logf("%s: %s %s", problem.Record.Path, problem.Kind, problem.Value)
+		}
+		t.Fatalf("expected only foo_fast to be reported as an extra symbol")
+	}
+	if problems[0].Baseline.Variant != "" {
+		t.Errorf("variant compared against %s", problems[0].Baseline.Path)
+	}
+}
@@ -17,11 +17,11 @@
 package libabi
 
 import (
-	"debug/elf"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -29,13 +29,15 @@ import (
 // A Report is used to traverse a given tree and identify any and all files
 // that seem "interesting".
 type Report struct {
-	Root   string                        // Root directory that we're scanning
-	Arches map[elf.Machine]*Architecture // Mapping of architectures
+	Root     string                            // Root directory that we're scanning
+	Packages []string                          // Packages exploded into the root, if any
+	Arches   map[ArchitectureKey]*Architecture // Mapping of architectures
 
 	wg        *sync.WaitGroup // Our wait group for multiprocessing
 	jobChan   chan *Record    // Jobs are pushed from the walker
 	storeChan chan *Record    // Single channel pulls all of the processed records
 	libDirs   []string        // Valid library directories
+	debug     *debugIndex     // Separate debug files within the root
 	nRecords  int             // The total number of records encountered
 	jobMutex  *sync.Mutex     // Lock for njobs decrement
 	nJobs     int             // Number of jobs, decrementing through runtime
@@ -54,22 +56,93 @@ func NewReport(root string) (*Report, error) {
 		filepath.Join(root, "usr", "lib64"),
 		filepath.Join(root, "usr", "lib"),
 		filepath.Join(root, "usr", "lib32"),
-		filepath.Join(root, "usr", "lib", "x86_64-linux-gnu"),
-		filepath.Join(root, "lib", "x86_64-linux-gnu"),
-		filepath.Join(root, "usr", "lib", "i386-linux-gnu"),
-		filepath.Join(root, "lib", "i386-linux-gnu"),
+		filepath.Join(root, "usr", "libx32"),
 	}
-	return &Report{
+	for _, dir := range multiarchLibDirs() {
+		libDirs = append(libDirs, filepath.Join(root, dir))
+	}
+
+	// Anything registered with the dynamic loader is a library directory
+	confDirs, err := ParseLdSoConf(root)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
 		Root:      root,
 		jobChan:   make(chan *Record),
 		storeChan: make(chan *Record),
 		wg:        new(sync.WaitGroup),
-		Arches:    make(map[elf.Machine]*Architecture),
+		Arches:    make(map[ArchitectureKey]*Architecture),
 		libDirs:   libDirs,
 		nRecords:  0,
 		jobMutex:  new(sync.Mutex),
 		nJobs:     runtime.NumCPU(),
-	}, nil
+	}
+	for _, dir := range confDirs {
+		report.AddLibDir(dir)
+	}
+	return report, nil
+}
+
+// AddLibDir will add a directory, relative to the root, to the set of valid
+// library directories whose libraries are exported.
+func (a *Report) AddLibDir(dir string) {
+	dir = filepath.Join(a.Root, dir)
+	if a.isLibraryDir(dir) {
+		return
+	}
+	a.libDirs = append(a.libDirs, dir)
+}
+
+// LibDirs will return the effective set of library directories, relative
+// to the root.
+func (a *Report) LibDirs() []string {
+	var ret []string
+	for _, dir := range a.libDirs {
+		rel, err := filepath.Rel(a.Root, dir)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, filepath.Join("/", rel))
+	}
+	return ret
+}
+
+// InstallPath will return the path of the record within the root, as it
+// would be installed on the target system.
+func (a *Report) InstallPath(record *Record) string {
+	return a.installPath(record.Path)
+}
+
+// SortedArches will return the architecture buckets of the report, sorted
+// by their key, so that output iterating them is reproducible.
+func (a *Report) SortedArches() []*Architecture {
+	var keys []ArchitectureKey
+	for key := range a.Arches {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Less(keys[j]) })
+
+	ret := make([]*Architecture, 0, len(keys))
+	for _, key := range keys {
+		ret = append(ret, a.Arches[key])
+	}
+	return ret
+}
+
+// DebugPath will return the path within the root of the separate debug file
+// found for the record, if any.
+func (a *Report) DebugPath(record *Record) string {
+	if record.DebugFile == "" {
+		return ""
+	}
+	return a.installPath(record.DebugFile)
+}
+
+// installPath will return the path within the root
+func (a *Report) installPath(path string) string {
+	return filepath.Join("/", strings.TrimPrefix(path, a.Root))
 }
 
 // IsAnELF determines if a file is an ELF file or not
@@ -121,7 +194,8 @@ func (a *Report) isPathInteresting(path string, info os.FileInfo) bool {
 	if info.Size() < 5 {
 		return false
 	}
-	// Really don't want to examine .debug files
+	// Really don't want to examine .debug files, they are only indexed
+	// to provide the debug information of stripped binaries.
 	if strings.Contains(path, "/debug/") && strings.HasSuffix(path, ".debug") {
 		return false
 	}
@@ -178,28 +252,78 @@ func (a *Report) jobProcessor() {
 	filepath.Walk(a.Root, a.walkTree)
 }
 
+// storeSymbols will store the symbols of a library record into the bucket
+func (a *Report) storeSymbols(bucket *Architecture, record *Record) {
+	symbolsTgt := bucket.GetSymbolsTarget(record)
+
+	// Ensure map is here so that the .soname provider is known
+	symbolsMap, ok := symbolsTgt[record.Name]
+	if !ok {
+		symbolsMap = make(map[string]bool)
+		symbolsTgt[record.Name] = symbolsMap
+	}
+
+	// Store a soname -> symbol mapping
+	// Quicker than actually using lists
+	for _, symbol := range record.Symbols {
+		if LegacySymbols {
+			symbolsMap[symbol.Name] = true
+		} else {
+			symbolsMap[symbol.String()] = true
+		}
+	}
+
+	// Version nodes are only of interest for the exported ABI
+	if len(record.Versions) > 0 && record.Flags&RecordTypeExport == RecordTypeExport {
+		versionsMap, ok := bucket.Versions[record.Name]
+		if !ok {
+			versionsMap = make(map[string]bool)
+			bucket.Versions[record.Name] = versionsMap
+		}
+		for _, version := range record.Versions {
+			versionsMap[version.String()] = true
+		}
+	}
+
+	// Prototypes are only known when debug information was found
+	if len(record.Signatures) > 0 && record.Flags&RecordTypeExport == RecordTypeExport {
+		signaturesMap, ok := bucket.Signatures[record.Name]
+		if !ok {
+			signaturesMap = make(map[string]bool)
+			bucket.Signatures[record.Name] = signaturesMap
+		}
+		for symbol, prototype := range record.Signatures {
+			signaturesMap[symbol+":"+prototype] = true
+		}
+	}
+
+	// As are the layouts of the types they use
+	if len(record.Types) > 0 && record.Flags&RecordTypeExport == RecordTypeExport {
+		typesMap, ok := bucket.Types[record.Name]
+		if !ok {
+			typesMap = make(map[string]bool)
+			bucket.Types[record.Name] = typesMap
+		}
+		for name, layout := range record.Types {
+			typesMap[name+" = "+layout] = true
+		}
+	}
+}
+
 // storeProcessor is responsible for storing into memory
 func (a *Report) storeProcessor() {
 	defer a.wg.Done()
 
 	for record := range a.storeChan {
-		var symbolsMap map[string]bool
-		var ok bool
 		a.nRecords++
 
 		bucket := a.GetBucket(record)
-		symbolsTgt := bucket.GetSymbolsTarget(record)
+		bucket.Records = append(bucket.Records, record)
 
-		// Ensure map is here so that the .soname provider is known
-		if symbolsMap, ok = symbolsTgt[record.Name]; !ok {
-			symbolsMap = make(map[string]bool)
-			symbolsTgt[record.Name] = symbolsMap
-		}
-
-		// Store a soname -> symbol mapping
-		// Quicker than actually using lists
-		for _, symbol := range record.Symbols {
-			symbolsMap[symbol] = true
+		// Only libraries provide symbols, executables are simply
+		// recorded for their dependencies.
+		if record.Flags&RecordTypeLibrary == RecordTypeLibrary {
+			a.storeSymbols(bucket, record)
 		}
 
 		for _, dep := range record.Dependencies {
@@ -211,6 +335,9 @@ func (a *Report) storeProcessor() {
 // Walk will attempt to walk the preconfigured tree, and collect a set
 // of "interesting" files along the way.
 func (a *Report) Walk() error {
+	// Debug files must be known before the binaries are analyzed
+	a.debug = newDebugIndex(a.Root)
+
 	a.wg.Add(2 + a.nJobs)
 	go a.jobProcessor()
 	go a.storeProcessor()